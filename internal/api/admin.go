@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"stream/pkg/logger"
+)
+
+// isAdmin reports whether the principal of ctx is one of admins.
+func isAdmin(ctx context.Context, admins func() []string) bool {
+	p, ok := PrincipalFromContext(ctx)
+	return ok && p.ID != "" && slices.Contains(admins(), p.ID)
+}
+
+// RequireAdmin returns a middleware that rejects requests of principals that
+// are not one of admins with 403. It must run after Authenticate.
+func RequireAdmin(l logger.Logger, admins func() []string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isAdmin(r.Context(), admins) {
+				requestLogger(r.Context(), l).Printf("rejecting request: %s is not an admin", ownerOf(r.Context()))
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DebugLogging returns a middleware that logs a request at debug level, from
+// then on, when it has an `X-Debug-Log: true` header and comes from one of
+// admins. The header of anyone else is ignored. It must run after
+// Authenticate.
+func DebugLogging(admins func() []string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if on, _ := strconv.ParseBool(r.Header.Get("X-Debug-Log")); on && isAdmin(r.Context(), admins) {
+				logger.SetContextLevel(r.Context(), logger.DebugLevel)
+				logger.AddFields(r.Context(), "debug", true)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// debug logs a message at debug level with the logger of the request ctx
+// belongs to, see DebugLogging.
+func (h *Handler) debug(ctx context.Context, msg string, args ...any) {
+	if l, ok := logger.FromContext(ctx); ok {
+		l.Debug(msg, args...)
+		return
+	}
+	logger.Adapt(h.logger).Debug(msg, args...)
+}
+
+// LogLevelBody is the log level of the service.
+type LogLevelBody struct {
+	Level string `json:"level"` // debug, info, warn or error
+}
+
+// GetLogLevel handles the GET /admin/log-level endpoint.
+//
+//	@Summary		Get the log level.
+//	@Description	Returns the least severe level of the messages logged. Only for ADMIN_USERS.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	LogLevelBody	"Current log level"
+//	@Failure		401	{string}	string			"Unauthorized"
+//	@Failure		403	{string}	string			"Forbidden"
+//	@Router			/admin/log-level [get]
+func (h *Handler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(LogLevelBody{Level: logger.GetLevel()}); err != nil {
+		h.log(r.Context()).Printf("failed to write response: %v", err)
+	}
+}
+
+// SetLogLevel handles the PUT /admin/log-level endpoint.
+//
+//	@Summary		Set the log level.
+//	@Description	Changes the least severe level of the messages logged, until the process restarts or LOG_LEVEL
+//	@Description	itself is changed and reloaded. Only for ADMIN_USERS.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		LogLevelBody	true	"New log level"
+//	@Success		200		{object}	LogLevelBody	"New log level"
+//	@Failure		400		{string}	string			"Bad Request"
+//	@Failure		401		{string}	string			"Unauthorized"
+//	@Failure		403		{string}	string			"Forbidden"
+//	@Router			/admin/log-level [put]
+func (h *Handler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var body LogLevelBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.log(r.Context()).Printf("failed to decode request body: %v", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// disabled is a valid level, but not one to set by accident remotely
+	if !slices.Contains([]string{"debug", "info", "warn", "error"}, body.Level) {
+		http.Error(w, "level must be debug, info, warn or error", http.StatusBadRequest)
+		return
+	}
+	// logged first, so the change shows even when raising the level
+	h.log(r.Context()).Printf("log level changed from %s to %s by %s", logger.GetLevel(), body.Level, ownerOf(r.Context()))
+	logger.SetLevel(body.Level)
+
+	h.GetLogLevel(w, r)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"stream/pkg/logger"
+	"strings"
+	"testing"
+)
+
+// asPrincipal authenticates every request as id, like Authenticate would.
+func asPrincipal(id string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), Principal{ID: id})))
+	})
+}
+
+func TestLogLevel(t *testing.T) {
+	defer logger.SetLevel(logger.GetLevel())
+	logger.SetLevel("info")
+
+	server := &Handler{logger: logger.NewStdLogger(log.Default())}
+	admins := func() []string { return []string{"alice"} }
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/log-level", RequireAdmin(server.logger, admins)(http.HandlerFunc(server.GetLogLevel)))
+	mux.Handle("PUT /admin/log-level", RequireAdmin(server.logger, admins)(http.HandlerFunc(server.SetLogLevel)))
+
+	do := func(user, method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		asPrincipal(user, mux).ServeHTTP(w, httptest.NewRequest(method, "/admin/log-level", strings.NewReader(body)))
+		return w
+	}
+
+	if w := do("bob", http.MethodPut, `{"level":"debug"}`); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin got %d; want 403", w.Code)
+	}
+	if w := do("alice", http.MethodPut, `{"level":"loud"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid level got %d; want 400", w.Code)
+	}
+	if w := do("alice", http.MethodPut, `{"level":"disabled"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("disabled level got %d; want 400", w.Code)
+	}
+	if logger.GetLevel() != "info" {
+		t.Fatalf("level = %s after rejected changes; want info", logger.GetLevel())
+	}
+
+	if w := do("alice", http.MethodPut, `{"level":"debug"}`); w.Code != http.StatusOK || w.Body.String() != "{\"level\":\"debug\"}\n" {
+		t.Errorf("got %d %s; want 200 and the new level", w.Code, w.Body)
+	}
+	if w := do("alice", http.MethodGet, ""); w.Body.String() != "{\"level\":\"debug\"}\n" {
+		t.Errorf("got %s; want the new level", w.Body)
+	}
+}
+
+func TestDebugLogging(t *testing.T) {
+	defer logger.SetLevel(logger.GetLevel())
+	logger.SetLevel("info")
+
+	var buf bytes.Buffer
+	server := &Handler{}
+	handler := func(user string) http.Handler {
+		inner := DebugLogging(func() []string { return []string{"alice"} })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			server.debug(r.Context(), "chunk sent", "content", "Hello")
+		}))
+		return Logging(logger.NewText(&buf), asPrincipal(user, inner))
+	}
+
+	for _, user := range []string{"alice", "bob"} {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/chat", nil)
+		req.Header.Set("X-Debug-Log", "true")
+		handler(user).ServeHTTP(httptest.NewRecorder(), req)
+
+		logged := strings.Contains(buf.String(), "level=DEBUG msg=\"chunk sent\"")
+		if want := user == "alice"; logged != want {
+			t.Errorf("debug line logged for %s = %v; want %v:\n%s", user, logged, want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	handler("alice").ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/chat", nil))
+	if strings.Contains(buf.String(), "DEBUG") {
+		t.Errorf("debug line logged without the header:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"stream/internal/audit"
+	"stream/internal/chat"
+	"time"
+)
+
+// auditExchange appends an exchange with endpoint that started at start to the
+// audit trail; the prompt is req.Messages. A failure to write it is logged,
+// the client has its answer already.
+func (h *Handler) auditExchange(ctx context.Context, endpoint string, start time.Time, req chat.ChatRequest, conversationID string, completions []audit.Completion, usage chat.Usage) {
+	if h.audit == nil {
+		return
+	}
+
+	prompt := make([]audit.Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		prompt[i] = audit.Message{Role: string(msg.Role), Content: messageText(msg)}
+	}
+	err := h.audit.Record(audit.Record{
+		RequestID:      RequestIDFromContext(ctx),
+		User:           ownerOf(ctx),
+		Endpoint:       endpoint,
+		Model:          string(req.Model),
+		ConversationID: conversationID,
+		Stream:         req.Stream,
+		Prompt:         prompt,
+		Completions:    completions,
+		Usage: audit.Usage{
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			TotalTokens:      usage.TotalTokens,
+		},
+		LatencyMS: time.Since(start).Milliseconds(),
+	})
+	if err != nil {
+		h.log(ctx).Printf("failed to audit exchange: %v", err)
+	}
+}
+
+// messageText returns the content of msg, or the text of its parts when it is
+// multimodal. Images are left out of the trail.
+func messageText(msg chat.Message) string {
+	if len(msg.Parts) == 0 {
+		return msg.Content
+	}
+	var text string
+	for _, part := range msg.Parts {
+		if part.Type != chat.ContentPartText {
+			continue
+		}
+		if text != "" {
+			text += "\n"
+		}
+		text += part.Text
+	}
+	return text
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/audit"
+	"stream/internal/chat"
+	"stream/internal/persistence"
+	"stream/pkg/logger"
+	"strings"
+	"testing"
+)
+
+func TestSendMessage_Audit(t *testing.T) {
+	mockClient := &mockGroqClient{
+		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
+			stream := make(chan *chat.ChatStreamResponse, 2)
+			stream <- &chat.ChatStreamResponse{Response: chat.ChatResponse{ID: "audit-id", Choices: []chat.Choice{{Delta: chat.Message{Content: "Write to bob@example.com"}}}}}
+			stream <- &chat.ChatStreamResponse{Response: chat.ChatResponse{
+				ID:      "audit-id",
+				Choices: []chat.Choice{{FinishReason: "stop"}},
+				Usage:   chat.Usage{PromptTokens: 7, CompletionTokens: 5, TotalTokens: 12},
+			}}
+			close(stream)
+			return stream, func() {}, nil
+		},
+		CompleteFn: func(ctx context.Context, req chat.ChatRequest) (*chat.ChatResponse, error) {
+			return &chat.ChatResponse{
+				ID:      "complete-id",
+				Choices: []chat.Choice{{Message: chat.Message{Role: "assistant", Content: "Hi"}, FinishReason: "length"}},
+				Usage:   chat.Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4},
+			}, nil
+		},
+	}
+
+	var trail bytes.Buffer
+	redactor, _ := audit.NewRedactor([]string{"email"}, "")
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     logger.NewText(io.Discard),
+		db:         persistence.NewInMemoryStore(),
+		audit:      audit.New(&trail, audit.Options{Redactor: redactor}),
+	}
+	handler := Logging(logger.NewText(io.Discard), asPrincipal("alice", http.HandlerFunc(server.SendMessage)))
+
+	for _, body := range []string{
+		`{"messages":[{"role":"user","content":"Who should I email? I am alice@example.com"}]}`,
+		`{"messages":[{"role":"user","content":"Hello"}],"stream":false}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(body))
+		req.Header.Set("X-Request-ID", "req-1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d; want 200", w.Code)
+		}
+	}
+
+	if strings.Contains(trail.String(), "@example.com") {
+		t.Errorf("emails were not redacted:\n%s", trail.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(trail.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d audit records; want 2:\n%s", len(lines), trail.String())
+	}
+
+	var streamed, complete audit.Record
+	if err := json.Unmarshal([]byte(lines[0]), &streamed); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &complete); err != nil {
+		t.Fatal(err)
+	}
+
+	if streamed.User != "alice" || streamed.RequestID != "req-1" || streamed.Endpoint != "/chat" || !streamed.Stream || streamed.ConversationID != "audit-id" {
+		t.Errorf("streamed record = %+v", streamed)
+	}
+	if len(streamed.Prompt) != 1 || streamed.Prompt[0].Content != "Who should I email? I am [email]" {
+		t.Errorf("streamed prompt = %+v", streamed.Prompt)
+	}
+	if len(streamed.Completions) != 1 || streamed.Completions[0].Content != "Write to [email]" || streamed.Completions[0].FinishReason != "stop" {
+		t.Errorf("streamed completions = %+v", streamed.Completions)
+	}
+	if streamed.Usage.TotalTokens != 12 {
+		t.Errorf("streamed usage = %+v; want 12 tokens", streamed.Usage)
+	}
+
+	if complete.Stream || complete.ConversationID != "complete-id" || complete.Completions[0].FinishReason != "length" || complete.Usage.TotalTokens != 4 {
+		t.Errorf("complete record = %+v", complete)
+	}
+}
+
+func TestChatCompletions_Audit(t *testing.T) {
+	chunks := []string{
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":2,"completion_tokens":1,"total_tokens":3}}`,
+	}
+	mockClient := &mockGroqClient{
+		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
+			stream := make(chan *chat.ChatStreamResponse, len(chunks))
+			for _, chunk := range chunks {
+				var resp chat.ChatResponse
+				_ = json.Unmarshal([]byte(chunk), &resp)
+				resp.Raw = json.RawMessage(chunk)
+				stream <- &chat.ChatStreamResponse{Response: resp}
+			}
+			close(stream)
+			return stream, func() {}, nil
+		},
+		CompleteFn: func(ctx context.Context, req chat.ChatRequest) (*chat.ChatResponse, error) {
+			raw := `{"id":"chatcmpl-2","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"length"}],"usage":{"total_tokens":4}}`
+			var resp chat.ChatResponse
+			_ = json.Unmarshal([]byte(raw), &resp)
+			resp.Raw = json.RawMessage(raw)
+			return &resp, nil
+		},
+	}
+
+	var trail bytes.Buffer
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     logger.NewText(io.Discard),
+		db:         persistence.NewInMemoryStore(),
+		audit:      audit.New(&trail, audit.Options{}),
+	}
+	handler := asPrincipal("alice", http.HandlerFunc(server.ChatCompletions))
+
+	for _, body := range []string{
+		`{"model":"llama3-8b-8192","stream":true,"messages":[{"role":"user","content":"Hello"}]}`,
+		`{"model":"llama3-8b-8192","messages":[{"role":"user","content":[{"type":"text","text":"Hi there"}]}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d; want 200", w.Code)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(trail.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d audit records; want 2:\n%s", len(lines), trail.String())
+	}
+	var streamed, complete audit.Record
+	if err := json.Unmarshal([]byte(lines[0]), &streamed); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &complete); err != nil {
+		t.Fatal(err)
+	}
+
+	if streamed.User != "alice" || streamed.Endpoint != "/v1/chat/completions" || !streamed.Stream || streamed.ConversationID != "chatcmpl-1" || streamed.Model != "llama3-8b-8192" {
+		t.Errorf("streamed record = %+v", streamed)
+	}
+	if len(streamed.Prompt) != 1 || streamed.Prompt[0].Content != "Hello" {
+		t.Errorf("streamed prompt = %+v", streamed.Prompt)
+	}
+	if len(streamed.Completions) != 1 || streamed.Completions[0].Content != "Hi" || streamed.Completions[0].FinishReason != "stop" || streamed.Usage.TotalTokens != 3 {
+		t.Errorf("streamed completions = %+v, usage = %+v", streamed.Completions, streamed.Usage)
+	}
+
+	if complete.Endpoint != "/v1/chat/completions" || complete.Stream || complete.ConversationID != "chatcmpl-2" || complete.Usage.TotalTokens != 4 {
+		t.Errorf("complete record = %+v", complete)
+	}
+	if len(complete.Prompt) != 1 || complete.Prompt[0].Content != "Hi there" {
+		t.Errorf("complete prompt = %+v", complete.Prompt)
+	}
+	if len(complete.Completions) != 1 || complete.Completions[0].Content != "Hello" || complete.Completions[0].FinishReason != "length" {
+		t.Errorf("complete completions = %+v", complete.Completions)
+	}
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"stream/internal/jwt"
+	"stream/internal/persistence"
+	"stream/pkg/logger"
+	"strings"
+)
+
+// Principal is the authenticated identity behind a request.
+type Principal struct {
+	ID     string // Owner of the conversations created by the request
+	Name   string // Label of the credential used, for logs
+	Method string // How the request was authenticated, e.g. "api_key"
+
+	Budget float64 // Monthly spend in USD that triggers an alert, 0 for the default
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal attached by an auth middleware.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// credentialOf returns what tells apart the credentials of an owner, e.g. its
+// API keys, in the usage store.
+func credentialOf(ctx context.Context) string {
+	p, _ := PrincipalFromContext(ctx)
+	return p.Method + ":" + p.Name
+}
+
+// ownerOf returns the ID conversations of the request are stored under.
+// Unauthenticated requests (e.g. in tests) share the empty owner.
+func ownerOf(ctx context.Context) string {
+	p, _ := PrincipalFromContext(ctx)
+	return p.ID
+}
+
+// HashAPIKey returns the hex encoded SHA-256 of an API key, the form keys are stored in.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadAPIKeys stores the keys of spec, a comma separated list of
+// `owner:sha256-hex`, `owner:name:sha256-hex` or `owner:name:sha256-hex:budget`
+// entries, budget being a monthly spend in USD with that key that triggers an
+// alert.
+func LoadAPIKeys(store persistence.APIKeyStore, spec string) (int, error) {
+	n := 0
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		fields := strings.Split(entry, ":")
+		var key persistence.APIKey
+		switch len(fields) {
+		case 2:
+			key = persistence.APIKey{Owner: fields[0], Name: fields[0], Hash: fields[1]}
+		case 3:
+			key = persistence.APIKey{Owner: fields[0], Name: fields[1], Hash: fields[2]}
+		case 4:
+			key = persistence.APIKey{Owner: fields[0], Name: fields[1], Hash: fields[2]}
+			budget, err := strconv.ParseFloat(fields[3], 64)
+			if err != nil || budget < 0 {
+				return n, fmt.Errorf("invalid budget for %q: want a non-negative amount in USD", key.Owner)
+			}
+			key.Budget = budget
+		default:
+			return n, fmt.Errorf("invalid api key entry %q: want owner:sha256, owner:name:sha256 or owner:name:sha256:budget", entry)
+		}
+
+		key.Hash = strings.ToLower(key.Hash)
+		if b, err := hex.DecodeString(key.Hash); err != nil || len(b) != sha256.Size || key.Owner == "" {
+			return n, fmt.Errorf("invalid api key entry for %q: want a non-empty owner and a hex encoded sha256", key.Owner)
+		}
+
+		if err := store.PutAPIKey(key); err != nil {
+			return n, fmt.Errorf("failed to store api key for %q: %w", key.Owner, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// bearerToken extracts the token of an `Authorization: Bearer` header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func unauthorized(w http.ResponseWriter, description string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, description))
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// errInvalidCredentials marks authentication failures caused by the client.
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticate returns a middleware that requires a bearer token and attaches
+// its principal to the request context. Tokens shaped like a JWT are checked
+// by verifier, anything else is looked up as an API key. Either of keys and
+// verifier may be nil to turn that method off.
+func Authenticate(l logger.Logger, keys persistence.APIKeyStore, verifier *jwt.Verifier) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				unauthorized(w, "missing bearer token")
+				return
+			}
+
+			var p Principal
+			var err error
+			switch {
+			case verifier != nil && jwt.LooksLikeJWT(token):
+				p, err = verifyJWT(r.Context(), verifier, token)
+			case keys != nil:
+				p, err = lookupAPIKey(keys, token)
+			default:
+				err = fmt.Errorf("%w: unsupported token", errInvalidCredentials)
+			}
+
+			if err != nil {
+				log := requestLogger(r.Context(), l)
+				switch {
+				case errors.Is(err, jwt.ErrKeySetUnavailable):
+					// the token may well be valid, the client can try again
+					log.Printf("failed to authenticate request: %v", err)
+					http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+				case !errors.Is(err, errInvalidCredentials):
+					log.Printf("failed to authenticate request: %v", err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				default:
+					log.Printf("rejecting request: %v", err)
+					unauthorized(w, "invalid token")
+				}
+				return
+			}
+
+			logger.AddFields(r.Context(), "user", p.ID)
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// APIKeyAuth rejects requests without a valid bearer API key and attaches the
+// key's principal to the request context.
+func APIKeyAuth(logger logger.Logger, keys persistence.APIKeyStore, next http.Handler) http.Handler {
+	return Authenticate(logger, keys, nil)(next)
+}
+
+// JWTAuth rejects requests without a valid bearer JWT and attaches the token's
+// user to the request context.
+func JWTAuth(logger logger.Logger, verifier *jwt.Verifier, next http.Handler) http.Handler {
+	return Authenticate(logger, nil, verifier)(next)
+}
+
+func lookupAPIKey(keys persistence.APIKeyStore, token string) (Principal, error) {
+	key, err := keys.GetAPIKey(HashAPIKey(token))
+	if err != nil {
+		if errors.Is(err, persistence.ErrAPIKeyNotFound) {
+			return Principal{}, fmt.Errorf("%w: unknown api key", errInvalidCredentials)
+		}
+		return Principal{}, fmt.Errorf("failed to look up api key: %w", err)
+	}
+	return Principal{ID: key.Owner, Name: key.Name, Method: "api_key", Budget: key.Budget}, nil
+}
+
+func verifyJWT(ctx context.Context, verifier *jwt.Verifier, token string) (Principal, error) {
+	claims, err := verifier.Verify(ctx, token)
+	if err != nil {
+		// a key set that fails to load is our problem, not the client's
+		var netErr interface{ Timeout() bool }
+		if errors.Is(err, jwt.ErrKeySetUnavailable) || errors.As(err, &netErr) {
+			return Principal{}, fmt.Errorf("failed to verify jwt: %w", err)
+		}
+		return Principal{}, fmt.Errorf("%w: %v", errInvalidCredentials, err)
+	}
+	return Principal{ID: claims.UserID, Name: claims.Subject, Method: "jwt"}, nil
+}
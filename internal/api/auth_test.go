@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/jwt"
+	"stream/internal/persistence"
+	"stream/pkg/logger"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	keys := persistence.NewInMemoryAPIKeyStore()
+	if _, err := LoadAPIKeys(keys, "alice:laptop:"+HashAPIKey("secret-key")); err != nil {
+		t.Fatalf("LoadAPIKeys returned error: %v", err)
+	}
+
+	var got Principal
+	handler := APIKeyAuth(logger.Info, keys, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"valid key", "Bearer secret-key", http.StatusOK},
+		{"lowercase scheme", "bearer secret-key", http.StatusOK},
+		{"missing header", "", http.StatusUnauthorized},
+		{"wrong scheme", "Basic secret-key", http.StatusUnauthorized},
+		{"unknown key", "Bearer other-key", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = Principal{}
+			req := httptest.NewRequest(http.MethodPost, "/chat", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if tt.status == http.StatusOK && (got.ID != "alice" || got.Name != "laptop" || got.Method != "api_key") {
+				t.Fatalf("unexpected principal: %+v", got)
+			}
+			if tt.status == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Bearer") {
+				t.Fatalf("expected a WWW-Authenticate challenge, got %q", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+type staticKey struct{ key crypto.PublicKey }
+
+func (s staticKey) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	return s.key, nil
+}
+
+// signES256 returns a compact ES256 token over claims.
+func signES256(t *testing.T, key *ecdsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	enc := base64.RawURLEncoding.EncodeToString
+	c, _ := json.Marshal(claims)
+	signed := enc([]byte(`{"alg":"ES256","typ":"JWT"}`)) + "." + enc(c)
+
+	sum := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signed + "." + enc(sig)
+}
+
+func TestAuthenticate_JWT(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	verifier := jwt.NewVerifier(staticKey{&key.PublicKey}, jwt.Config{Audience: "stream"})
+
+	keys := persistence.NewInMemoryAPIKeyStore()
+	if _, err := LoadAPIKeys(keys, "alice:"+HashAPIKey("secret-key")); err != nil {
+		t.Fatalf("LoadAPIKeys returned error: %v", err)
+	}
+
+	var got Principal
+	handler := Authenticate(logger.Info, keys, verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	}))
+
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		want   Principal
+	}{
+		{"jwt", signES256(t, key, map[string]any{"sub": "bob", "aud": "stream", "exp": exp}), http.StatusOK, Principal{ID: "bob", Name: "bob", Method: "jwt"}},
+		{"api key", "secret-key", http.StatusOK, Principal{ID: "alice", Name: "alice", Method: "api_key"}},
+		{"expired jwt", signES256(t, key, map[string]any{"sub": "bob", "aud": "stream", "exp": time.Now().Add(-time.Hour).Unix()}), http.StatusUnauthorized, Principal{}},
+		{"wrong audience", signES256(t, key, map[string]any{"sub": "bob", "aud": "other", "exp": exp}), http.StatusUnauthorized, Principal{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = Principal{}
+			req := httptest.NewRequest(http.MethodPost, "/chat", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if got != tt.want {
+				t.Fatalf("expected principal %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	hash := HashAPIKey("k")
+
+	tests := []struct {
+		spec    string
+		n       int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"alice:" + hash + ", bob:ci:" + strings.ToUpper(hash), 2, false},
+		{"alice", 0, true},
+		{"alice:not-a-hash", 0, true},
+		{":" + hash, 0, true},
+		{"alice:laptop:" + hash + ":25.5", 1, false},
+		{"alice:laptop:" + hash + ":lots", 0, true},
+	}
+
+	for _, tt := range tests {
+		n, err := LoadAPIKeys(persistence.NewInMemoryAPIKeyStore(), tt.spec)
+		if (err != nil) != tt.wantErr || n != tt.n {
+			t.Errorf("LoadAPIKeys(%q) = %d, %v; want %d, error=%v", tt.spec, n, err, tt.n, tt.wantErr)
+		}
+	}
+}
+
+func TestSelectChoice_ScopedToOwner(t *testing.T) {
+	db := persistence.NewInMemoryStore()
+	_ = db.AppendMessage("alice", "convo", persistence.Message{Role: "assistant", Content: "a", Alternates: []string{"a", "b"}})
+
+	server := &Handler{
+		logger: logger.Info,
+		db:     db,
+	}
+
+	for owner, status := range map[string]int{"alice": http.StatusOK, "mallory": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodPost, "/conversations/convo/choice", strings.NewReader(`{"index":1}`))
+		req.SetPathValue("id", "convo")
+		req = req.WithContext(WithPrincipal(req.Context(), Principal{ID: owner}))
+		w := httptest.NewRecorder()
+
+		server.SelectChoice(w, req)
+
+		if w.Code != status {
+			t.Errorf("%s: expected status %d, got %d", owner, status, w.Code)
+		}
+	}
+}
+
+func TestAuthenticate_KeySetUnavailable(t *testing.T) {
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer jwks.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	verifier := jwt.NewVerifier(jwt.NewJWKS(jwks.URL, time.Hour), jwt.Config{Audience: "stream"})
+	handler := Authenticate(logger.Info, nil, verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodPost, "/chat", nil)
+	req.Header.Set("Authorization", "Bearer "+signES256(t, key, map[string]any{"sub": "bob", "aud": "stream", "exp": time.Now().Add(time.Hour).Unix()}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 when the key set is down, got %d", w.Code)
+	}
+}
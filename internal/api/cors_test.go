@@ -0,0 +1,179 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/config"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	cfg := config.Defaults().CORS
+	cfg.AllowedOrigins = []string{"https://app.example.com", "https://*.preview.example.com"}
+	cfg.AllowCredentials = true
+	cfg.MaxAge = time.Hour
+
+	reached := false
+	handler := CORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.Header().Set("X-Conversation-ID", "some-id")
+	}))
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+
+		status      int
+		reached     bool
+		allowOrigin string
+		want        map[string]string
+	}{
+		{
+			name:        "simple request",
+			method:      http.MethodPost,
+			headers:     map[string]string{"Origin": "https://app.example.com"},
+			status:      http.StatusOK,
+			reached:     true,
+			allowOrigin: "https://app.example.com",
+			want: map[string]string{
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Conversation-ID, X-Request-ID, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:    "no origin",
+			method:  http.MethodPost,
+			status:  http.StatusOK,
+			reached: true,
+		},
+		{
+			name:    "disallowed origin",
+			method:  http.MethodPost,
+			headers: map[string]string{"Origin": "https://evil.example.com"},
+			status:  http.StatusOK,
+			reached: true,
+		},
+		{
+			name:   "preflight",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "content-type, authorization",
+			},
+			status:      http.StatusNoContent,
+			allowOrigin: "https://app.example.com",
+			want: map[string]string{
+				"Access-Control-Allow-Methods":     "GET, POST",
+				"Access-Control-Allow-Headers":     "Content-Type, Authorization",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "3600",
+			},
+		},
+		{
+			name:   "preflight from a pattern origin",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://pr-42.preview.example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			status:      http.StatusNoContent,
+			allowOrigin: "https://pr-42.preview.example.com",
+		},
+		{
+			name:   "preflight pattern needs a subdomain",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://.preview.example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "preflight from a disallowed origin",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://evil.example.com",
+				"Access-Control-Request-Method": "POST",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "preflight with a disallowed method",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "preflight with a disallowed header",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "Content-Type, X-Debug",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:        "options without a request method isn't a preflight",
+			method:      http.MethodOptions,
+			headers:     map[string]string{"Origin": "https://app.example.com"},
+			status:      http.StatusOK,
+			reached:     true,
+			allowOrigin: "https://app.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = false
+			req := httptest.NewRequest(tt.method, "/chat", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if reached != tt.reached {
+				t.Fatalf("expected the handler to be reached: %v, got %v", tt.reached, reached)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Fatalf("expected Access-Control-Allow-Origin %q, got %q", tt.allowOrigin, got)
+			}
+			for k, v := range tt.want {
+				if got := w.Header().Get(k); got != v {
+					t.Fatalf("expected %s %q, got %q", k, v, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCORS_AnyOrigin(t *testing.T) {
+	handler := CORS(config.Defaults().CORS)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/chat", nil)
+	req.Header.Set("Origin", "https://anywhere.test")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "Authorization")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("expected any origin to be allowed, got %d %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatal("expected credentials not to be allowed")
+	}
+}
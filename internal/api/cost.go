@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"stream/internal/chat"
+	"stream/internal/persistence"
+	"stream/pkg/logger"
+	"sync"
+	"time"
+)
+
+// webhookTimeout bounds the delivery of a budget alert.
+const webhookTimeout = 10 * time.Second
+
+// Accounting holds what usage accounting and cost tracking run on. Quotas and
+// the default budget are part of config.Config.
+type Accounting struct {
+	Usage   persistence.UsageStore // nil turns accounting off
+	Pricing chat.Pricing           // Models without a price cost nothing
+	Alerter BudgetAlerter          // Notified when a budget is crossed, may be nil
+}
+
+// BudgetAlert reports that a spend this month crossed its budget: the spend of
+// an API key with its own budget, the owner's otherwise.
+type BudgetAlert struct {
+	Owner  string  `json:"owner"`
+	Key    string  `json:"key,omitempty"` // Credential used by the request that crossed the budget
+	Month  string  `json:"month"`         // YYYY-MM
+	Budget float64 `json:"budget"`        // In USD
+	Spent  float64 `json:"spent"`         // In USD, this month, with the key when it has a budget
+}
+
+// BudgetAlerter delivers budget alerts.
+type BudgetAlerter interface {
+	Alert(ctx context.Context, alert BudgetAlert) error
+}
+
+// WebhookAlerter posts budget alerts as JSON to a URL.
+type WebhookAlerter struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookAlerter(url string) *WebhookAlerter {
+	return &WebhookAlerter{
+		URL:    url,
+		Client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (a *WebhookAlerter) Alert(ctx context.Context, alert BudgetAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := a.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post alert: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook answered with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// UsageEvent is sent as the `usage` event at the end of a /chat stream.
+type UsageEvent struct {
+	Usage chat.Usage `json:"usage"`          // Tokens of every generation of the request
+	Cost  *float64   `json:"cost,omitempty"` // In USD, when the model has a price
+}
+
+// costOf returns the cost of usage with model, or nil if the model has no price.
+func (h *Handler) costOf(model chat.ModelID, usage chat.Usage) *float64 {
+	cost, ok := h.pricing.Cost(model, usage)
+	if !ok {
+		return nil
+	}
+	return &cost
+}
+
+// checkBudget raises an alert, once a month, when a spend this month reached
+// its budget: the spend with the caller's key against the key's own budget,
+// or the owner's spend against the default one.
+func (h *Handler) checkBudget(ctx context.Context, now time.Time) {
+	p, _ := PrincipalFromContext(ctx)
+	budget, key := p.Budget, credentialOf(ctx)
+	if budget == 0 {
+		budget, key = h.settings().Budget.MonthlyUSD, ""
+	}
+	if budget == 0 {
+		return
+	}
+
+	now = now.UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var usage []persistence.Usage
+	var err error
+	if key != "" {
+		usage, err = h.usage.GetKeyUsage(p.ID, key, monthStart, now)
+	} else {
+		usage, err = h.usage.GetUsage(p.ID, monthStart, now)
+	}
+	if err != nil {
+		h.log(ctx).Printf("failed to check budget: %v", err)
+		return
+	}
+	var spent float64
+	for _, u := range usage {
+		spent += u.Cost
+	}
+	if spent < budget {
+		return
+	}
+
+	// every later request, and concurrent ones, see the crossing too; only
+	// the first alerts
+	alert := BudgetAlert{Owner: p.ID, Key: p.Name, Month: now.Format("2006-01"), Budget: budget, Spent: spent}
+	if !h.alerted.first(alert.Month, alert.Owner+"/"+key) {
+		return
+	}
+
+	logger.Adapt(h.log(ctx)).Warn("budget crossed", "owner", alert.Owner, "spent", alert.Spent, "budget", alert.Budget, "month", alert.Month)
+	if h.alerter == nil {
+		return
+	}
+	go func() {
+		// the request may be over before the webhook answers
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), webhookTimeout)
+		defer cancel()
+		if err := h.alerter.Alert(ctx, alert); err != nil {
+			h.log(ctx).Printf("failed to send budget alert: %v", err)
+		}
+	}()
+}
+
+// budgetAlerts remembers the budgets alerted on in the current month, so each
+// alerts once; those of earlier months are forgotten.
+type budgetAlerts struct {
+	mu    sync.Mutex
+	month string
+	seen  map[string]bool
+}
+
+// first reports whether budget, crossed in month, wasn't alerted on yet.
+func (a *budgetAlerts) first(month, budget string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case month < a.month:
+		// a request that started before the turn of the month
+		return false
+	case month > a.month:
+		a.month, a.seen = month, make(map[string]bool)
+	}
+	if a.seen[budget] {
+		return false
+	}
+	a.seen[budget] = true
+	return true
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errShutdown is the cause of the cancellation of streams still running once
+// the drain window is over.
+var errShutdown = errors.New("server is shutting down")
+
+// ShutdownEvent is sent as the `shutdown` event of a /chat stream ended by a
+// shutdown, after what was generated so far. The client should retry.
+type ShutdownEvent struct {
+	Message string `json:"message"`
+}
+
+// drainState tracks the shutdown of a Handler, see Drain. Its zero value is
+// not draining.
+type drainState struct {
+	init     sync.Once
+	start    sync.Once
+	draining chan struct{} // Closed once draining starts
+	over     chan struct{} // Closed once streams must end
+
+	mu       sync.Mutex // Orders writes.Add before writes.Wait
+	flushing bool
+	writes   sync.WaitGroup
+}
+
+func (d *drainState) channels() (draining, over chan struct{}) {
+	d.init.Do(func() {
+		d.draining = make(chan struct{})
+		d.over = make(chan struct{})
+	})
+	return d.draining, d.over
+}
+
+func (d *drainState) isDraining() bool {
+	draining, _ := d.channels()
+	select {
+	case <-draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain starts the shutdown of the handler: readiness fails, requests wrapped
+// by RefuseWhenDraining are refused, and streams still running after window
+// are ended with a shutdown event.
+func (h *Handler) Drain(window time.Duration) {
+	draining, over := h.drain.channels()
+	h.drain.start.Do(func() {
+		close(draining)
+		time.AfterFunc(window, func() { close(over) })
+	})
+}
+
+// Flush waits until the conversations of the requests served are saved, or
+// until ctx is done. It is called once the server has shut down; requests
+// still in progress after that save theirs before returning.
+func (h *Handler) Flush(ctx context.Context) error {
+	h.drain.mu.Lock()
+	h.drain.flushing = true
+	h.drain.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.drain.writes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RefuseWhenDraining returns next, which answers 503 and closes the connection
+// once the handler is draining, so clients retry on another instance.
+func (h *Handler) RefuseWhenDraining(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.drain.isDraining() {
+			h.log(r.Context()).Printf("rejecting request: %v", errShutdown)
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// untilDrained returns a copy of ctx that is canceled with errShutdown once
+// the drain window is over.
+func (h *Handler) untilDrained(ctx context.Context) (context.Context, context.CancelFunc) {
+	_, over := h.drain.channels()
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-over:
+			cancel(errShutdown)
+		}
+	}()
+	return ctx, func() { cancel(nil) }
+}
+
+// shutDown reports whether ctx was canceled by the end of the drain window.
+func shutDown(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errShutdown)
+}
+
+// persist saves the exchange in the background, see persistMessages. Flush
+// waits for it; once Flush was called it is saved right away instead, as
+// writes.Add must not race with writes.Wait.
+func (h *Handler) persist(ctx context.Context, conversationID string, userMessages []ChatMessage, replies []string) {
+	h.drain.mu.Lock()
+	if h.drain.flushing {
+		h.drain.mu.Unlock()
+		h.persistMessages(context.WithoutCancel(ctx), ownerOf(ctx), conversationID, userMessages, replies)
+		return
+	}
+	h.drain.writes.Add(1)
+	h.drain.mu.Unlock()
+	go func() {
+		defer h.drain.writes.Done()
+		h.persistMessages(context.WithoutCancel(ctx), ownerOf(ctx), conversationID, userMessages, replies)
+	}()
+}
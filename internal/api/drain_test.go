@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/chat"
+	"stream/internal/config"
+	"stream/internal/persistence"
+	"stream/pkg/logger"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrain_RefusesRequests(t *testing.T) {
+	server := &Handler{
+		logger: logger.NewText(io.Discard),
+		db:     persistence.NewInMemoryStore(),
+		cfg:    testConfig(func(c *config.Config) { c.GroqAPIKey = "key" }),
+	}
+	handler := server.RefuseWhenDraining(http.HandlerFunc(server.Status))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d before the shutdown; want 200", w.Code)
+	}
+
+	server.Drain(time.Minute)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Connection") != "close" {
+		t.Errorf("got %d, Connection %q while draining; want 503 and close", w.Code, w.Header().Get("Connection"))
+	}
+
+	w = httptest.NewRecorder()
+	server.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var body HealthBody
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusServiceUnavailable || body.Checks["shutdown"].Status != "fail" {
+		t.Errorf("readiness got %d %+v while draining; want 503 and a failed shutdown check", w.Code, body)
+	}
+}
+
+func TestDrain_EndsStreams(t *testing.T) {
+	sent := make(chan struct{})
+	mockClient := &mockGroqClient{
+		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
+			stream := make(chan *chat.ChatStreamResponse)
+			go func() {
+				defer close(stream)
+				stream <- &chat.ChatStreamResponse{Response: chat.ChatResponse{ID: "drain-id", Choices: []chat.Choice{{Delta: chat.Message{Content: "Once upon"}}}}}
+				close(sent)
+				// the provider goes on until the request is canceled
+				<-ctx.Done()
+			}()
+			return stream, func() {}, nil
+		},
+	}
+
+	db := persistence.NewInMemoryStore()
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     logger.NewText(io.Discard),
+		db:         db,
+	}
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(`{"messages":[{"role":"user","content":"Tell me a story"}]}`))
+		server.SendMessage(w, req)
+	}()
+
+	<-sent
+	server.Drain(10 * time.Millisecond)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still running after the drain window")
+	}
+
+	want := "data: Once upon\n\nevent: shutdown\ndata: {\"message\":\"server is shutting down\"}\n\n"
+	if w.Body.String() != want {
+		t.Errorf("got stream %q; want %q", w.Body.String(), want)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := db.GetRecentMessages("", "drain-id", 20)
+	if len(stored) != 2 || stored[1].Content != "Once upon" {
+		t.Errorf("got stored messages %+v; want the partial reply", stored)
+	}
+}
+
+func TestFlush_LateWrites(t *testing.T) {
+	db := persistence.NewInMemoryStore()
+	server := &Handler{logger: logger.NewText(io.Discard), db: db}
+
+	// a request outliving the shutdown saves its conversation after Flush
+	// started waiting
+	if err := server.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	server.persist(context.Background(), "late", []ChatMessage{{Role: "user", Content: "Hi"}}, []string{"Hello"})
+
+	if messages, _ := db.GetRecentMessages("", "late", 10); len(messages) != 2 {
+		t.Errorf("got %d saved messages after Flush; want 2", len(messages))
+	}
+}
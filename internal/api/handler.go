@@ -3,41 +3,88 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
-	"strconv"
+	"stream/internal/audit"
 	"stream/internal/chat"
+	"stream/internal/config"
+	"stream/internal/metrics"
 	"stream/internal/persistence"
+	"stream/internal/tracing"
 	"stream/pkg/logger"
 	"strings"
+	"time"
 )
 
+// maxChatBodySize caps the size of /chat request bodies: the largest images
+// allowed, base64 encoded, and room for the text.
+const maxChatBodySize = maxImagesPerRequest*maxImageBytes*4/3 + 1<<20
+
 type Handler struct {
 	logger     logger.Logger
 	groqClient chat.GroqClient
 	db         persistence.ConversationStore
+	images     persistence.ImageStore
+	cfg        *config.Live           // nil uses the defaults
+	usage      persistence.UsageStore // nil turns usage accounting off
+	pricing    chat.Pricing
+	alerter    BudgetAlerter
+	metrics    *metrics.Metrics // nil turns metrics off
+	tracer     *tracing.Tracer  // nil turns tracing off
+	audit      *audit.Trail     // nil turns auditing off
+	upstream   upstreamProbe    // Cached outcome of the readiness check of the provider
+	alerted    budgetAlerts     // Budget alerts already raised this month
+	drain      drainState
 }
 
-func NewHandler(logger logger.Logger, db persistence.ConversationStore) *Handler {
-	groqClient := chat.NewGroqClient(os.Getenv("GROQ_API_KEY"))
+func NewHandler(logger logger.Logger, cfg *config.Live, db persistence.ConversationStore, images persistence.ImageStore, accounting Accounting, m *metrics.Metrics, t *tracing.Tracer, a *audit.Trail) *Handler {
+	groqClient := chat.NewGroqClient(cfg.Get().GroqAPIKey.Reveal())
 	return &Handler{
 		logger:     logger,
 		groqClient: groqClient,
 		db:         db,
+		images:     images,
+		cfg:        cfg,
+		usage:      accounting.Usage,
+		pricing:    accounting.Pricing,
+		alerter:    accounting.Alerter,
+		metrics:    m,
+		tracer:     t,
+		audit:      a,
+	}
+}
+
+// log returns the logger of the request ctx belongs to.
+func (h *Handler) log(ctx context.Context) logger.Logger {
+	return requestLogger(ctx, h.logger)
+}
+
+var defaultSettings = config.Defaults()
+
+// settings returns the configuration in effect. Handlers read it once per
+// request so a reload can't change the settings halfway through.
+func (h *Handler) settings() *config.Config {
+	if h.cfg == nil {
+		return &defaultSettings
 	}
+	return h.cfg.Get()
 }
 
+// ChatMessage is a message sent by the client. Its content is either a string
+// or an array of text and image_url parts.
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string             `json:"role"`
+	Content string             `json:"content"`
+	Parts   []chat.ContentPart `json:"-"` // Set when the content is an array of parts
 }
 
-type ChatRequest struct {
-	Messages    []ChatMessage `json:"messages"`
-	Model       string        `json:"model"`
-	Temperature float64       `json:"temperature"`
-	MaxTokens   int           `json:"max_completion_tokens"`
+type ChatRequestBody struct {
+	Messages []ChatMessage `json:"messages"`
+	Model    chat.ModelID  `json:"model,omitempty"`  // Defaults to the DEFAULT_MODEL setting
+	Stream   *bool         `json:"stream,omitempty"` // Defaults to true; false returns a single JSON response
+
+	Temperature *float64 `json:"temperature,omitempty"` // Sampling temperature, defaults to 0.7
 	/*
 		Use top_p < 1.0 (e.g. 0.85) if you want less rambling and more concise completions.
 
@@ -45,67 +92,124 @@ type ChatRequest struct {
 
 		Keep temperature and top_p balanced — don’t set both to extreme values simultaneously (like temperature: 1.5 and top_p: 0.1), or you'll get odd outputs.
 	*/
-	TopP   float64 `json:"top_p"`
-	Stream bool    `json:"stream"`
+	TopP             *float64      `json:"top_p,omitempty"`                           // Nucleus sampling probability, defaults to 0.85
+	MaxTokens        *int          `json:"max_tokens,omitempty"`                      // Defaults to the MAX_TOKENS setting
+	Seed             *int          `json:"seed,omitempty"`                            // Seed for deterministic sampling
+	Stop             StopSequences `json:"stop,omitempty" swaggertype:"array,string"` // Up to 4 sequences where generation stops, or a single one as a string
+	PresencePenalty  float64       `json:"presence_penalty,omitempty"`                // Between -2 and 2
+	FrequencyPenalty float64       `json:"frequency_penalty,omitempty"`               // Between -2 and 2
+	UserID           string        `json:"user,omitempty"`                            // Unique identifier for the end-user
+	N                *int          `json:"n,omitempty"`                               // Number of choices to generate, streamed side by side
+
+	ResponseFormat *chat.ResponseFormat `json:"response_format,omitempty"`  // json_object or json_schema, validated at the end of the reply
+	RetryOnInvalid bool                 `json:"retry_on_invalid,omitempty"` // Generate once more if the reply fails validation
 }
 
-type ChatRequestBody struct {
-	Messages []ChatMessage `json:"messages"`
-	Model    chat.ModelID  `json:"model,omitempty"`
+// ChatResponseBody is returned by /chat when streaming is turned off.
+type ChatResponseBody struct {
+	ID           string      `json:"id"`
+	Message      ChatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason"`
+	Usage        chat.Usage  `json:"usage"`
+	Cost         *float64    `json:"cost,omitempty"` // In USD, when the model has a price
+
+	Validation *ValidationResult `json:"validation,omitempty"` // Set when a JSON response format was requested
+	Choices    []ChoiceBody      `json:"choices,omitempty"`    // Every choice, when more than one was requested
+}
+
+// ChoiceBody is one of the choices returned when n > 1.
+type ChoiceBody struct {
+	Index        int               `json:"index"`
+	Message      ChatMessage       `json:"message"`
+	FinishReason string            `json:"finish_reason"`
+	Validation   *ValidationResult `json:"validation,omitempty"`
 }
 
 // SendMessage handles the POST /chat endpoint.
 //
 //	@Summary		Send a message to the LLM and receive a streamed response.
 //	@Description	This endpoint allows users to send a chat message to the LLM and receive a streamed response.
+//	@Description	The stream is a `text/event-stream` of server-sent events: every delta of the reply is the `data:` of a
+//	@Description	default message event, split into one `data:` line per line of the delta. Before the SSE format the body
+//	@Description	was the raw text of the deltas; clients reading it as such must parse the events now.
+//	@Description	A `usage` event ends the stream when the provider reports usage, and a `shutdown` event ends a stream cut short by a shutdown.
+//	@Description	Send `Accept: application/json` or `"stream": false` to get the whole completion as a single JSON body instead.
+//	@Description	With a JSON `response_format` the reply is validated once complete and a `validation` event is sent.
+//	@Description	With `n` > 1 the deltas of every choice are sent on their own `choice-<index>` event.
 //	@Tags			chat
 //	@Accept			json
-//	@Produce		text/event-stream
+//	@Produce		text/event-stream,json
 //	@Param			body	body		ChatRequestBody	true	"Chat request body"
 //	@Success		200		{string}	string			"Streamed response"
-//	@Failure		400		{string}	string			"Bad Request"
+//	@Success		200		{object}	ChatResponseBody	"Complete response when streaming is off"
+//	@Failure		400		{object}	ValidationErrorBody	"Invalid request fields"
+//	@Failure		429		{string}	string			"Token quota exceeded"
 //	@Failure		500		{string}	string			"Internal Server Error"
 //	@Router			/chat [post]
 func (h *Handler) SendMessage(w http.ResponseWriter, r *http.Request) { // Request
-	maxTokens, err := strconv.Atoi(os.Getenv("MAX_TOKENS"))
-	if err != nil {
-		h.logger.Printf("failed to parse MAX_TOKENS: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
 	// get the body from the request body
 	// message should have this format: { body: [] ChatMessage{ role: "user", content: "Hello" }}
+	start := time.Now()
 	var body ChatRequestBody
-	if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
-		h.logger.Printf("failed to decode request body: %v", err)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxChatBodySize)).Decode(&body); err != nil {
+		h.log(r.Context()).Printf("failed to decode request body: %v", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	var model chat.ModelID
-	if body.Model == "" {
-		model = chat.ModelIDLLAMA38B
-	} else {
-		model = body.Model
+	cfg := h.settings()
+	model := body.Model
+	if model == "" {
+		model = chat.ModelID(cfg.DefaultModel)
+	}
+	logger.AddFields(r.Context(), "model", model)
+
+	if verr := body.validate(model); verr != nil {
+		h.log(r.Context()).Printf("rejecting request: %v", verr)
+		writeValidationError(w, verr)
+		return
+	}
+
+	if !h.checkQuota(w, r) {
+		return
 	}
 
+	// the response format was checked by validate, so this can't fail
+	validator, _ := newOutputValidator(body.ResponseFormat)
+	stream := wantsStream(r, body)
+
 	req := chat.ChatRequest{
-		Messages:    []chat.Message{},
-		Model:       model,
-		Stream:      true,
-		Temperature: 0.7,
-		TopP:        0.85,
-		MaxTokens:   maxTokens,
+		Messages:  []chat.Message{},
+		Model:     model,
+		Stream:    stream,
+		MaxTokens: cfg.MaxTokens,
+	}
+	body.applySampling(&req)
+	if cfg.SystemPrompt != "" && !hasSystemMessage(body.Messages) {
+		req.Messages = append(req.Messages, chat.Message{Role: chat.MessageRoleSystem, Content: cfg.SystemPrompt})
 	}
 	// add the user messages to the request
 	for _, msg := range body.Messages {
-		if err = addMessageToRequest(&req, msg); err != nil {
-			h.logger.Printf("failed to add message to request: %v", err)
+		if err := addMessageToRequest(&req, msg); err != nil {
+			h.log(r.Context()).Printf("failed to add message to request: %v", err)
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 	}
+	if validator != nil {
+		validator.apply(&req)
+	}
+
+	if !stream {
+		h.completeMessage(w, r, start, req, body, validator)
+		return
+	}
+	req.StreamOptions = &chat.StreamOptions{IncludeUsage: true}
 
 	// set the headers for SSE before writing calling the Groq API
 	// to catch any client disconnects early
@@ -118,30 +222,158 @@ func (h *Handler) SendMessage(w http.ResponseWriter, r *http.Request) { // Reque
 
 	go func() {
 		<-r.Context().Done()
-		h.logger.Println("client disconnected, cancelling context")
+		h.log(r.Context()).Println("client disconnected, cancelling context")
 		cancel()
 	}()
+	ctx, stop := h.untilDrained(ctx)
+	defer stop()
+
+	reply, ok := h.streamReply(ctx, w, req)
+	if !ok {
+		return
+	}
+
+	// a reply cut short by a shutdown is neither validated nor retried
+	if validator != nil && !shutDown(ctx) {
+		retry := false
+		for i, text := range reply.replies {
+			result := validator.check(text, 1)
+			result.Index = i
+			result.Retrying = !result.Valid && body.RetryOnInvalid
+			if err := writeJSONEvent(w, "validation", result); err != nil {
+				h.log(r.Context()).Printf("failed to write validation event: %v", err)
+				return
+			}
+			if result.Retrying {
+				h.log(r.Context()).Printf("output of %s failed validation, retrying: %v", reply.conversationID, result.Errors)
+				h.metrics.Retry("validation")
+				req.Messages = append(req.Messages, retryMessages(text, result)...)
+				retry = true
+			}
+		}
+
+		// retries are only allowed with a single choice, see validate
+		if retry {
+			retried, ok := h.streamReply(ctx, w, req)
+			if !ok {
+				return
+			}
+			retried.usage = addUsage(reply.usage, retried.usage)
+			reply = retried
+			if !shutDown(ctx) {
+				if err := writeJSONEvent(w, "validation", validator.check(reply.replies[0], 2)); err != nil {
+					h.log(r.Context()).Printf("failed to write validation event: %v", err)
+					return
+				}
+			}
+		}
+	}
 
+	// the provider reports usage in the final chunk of a stream
+	if reply.usage.TotalTokens > 0 {
+		if err := writeJSONEvent(w, "usage", UsageEvent{Usage: reply.usage, Cost: h.costOf(model, reply.usage)}); err != nil {
+			h.log(r.Context()).Printf("failed to write usage event: %v", err)
+			return
+		}
+	}
+
+	// what was generated until then is still saved
+	if shutDown(ctx) {
+		h.log(r.Context()).Printf("ending stream of %s: %v", reply.conversationID, errShutdown)
+		if err := writeJSONEvent(w, "shutdown", ShutdownEvent{Message: errShutdown.Error()}); err != nil {
+			h.log(r.Context()).Printf("failed to write shutdown event: %v", err)
+		}
+	}
+
+	h.auditExchange(r.Context(), "/chat", start, req, reply.conversationID, reply.completions(), reply.usage)
+	h.persist(r.Context(), reply.conversationID, body.Messages, reply.replies)
+}
+
+// addUsage sums the token counts of two generations.
+func addUsage(a, b chat.Usage) chat.Usage {
+	a.PromptTokens += b.PromptTokens
+	a.CompletionTokens += b.CompletionTokens
+	a.TotalTokens += b.TotalTokens
+	a.PromptTime += b.PromptTime
+	a.CompletionTime += b.CompletionTime
+	a.TotalTime += b.TotalTime
+	return a
+}
+
+// choiceEvent returns the SSE event name used for the deltas of a choice.
+// A single choice uses the default message event; with n > 1 every choice is
+// sent on its own `choice-<index>` event.
+func choiceEvent(n, index int) string {
+	if n <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("choice-%d", index)
+}
+
+// streamedReply is a generation streamed by streamReply.
+type streamedReply struct {
+	conversationID string
+	replies        []string // Whole reply of each choice
+	finishReasons  []string // Why each choice stopped, when the provider said
+	usage          chat.Usage
+}
+
+// completions returns the choices of the reply for the audit trail.
+func (s streamedReply) completions() []audit.Completion {
+	completions := make([]audit.Completion, len(s.replies))
+	for i, reply := range s.replies {
+		completions[i] = audit.Completion{Index: i, Content: reply, FinishReason: s.finishReasons[i]}
+	}
+	return completions
+}
+
+// streamReply streams a generation to the client as SSE events, demultiplexing
+// the deltas of every choice by their index. It returns the whole generation,
+// and false if the stream failed and the request should be abandoned.
+func (h *Handler) streamReply(ctx context.Context, w http.ResponseWriter, req chat.ChatRequest) (streamedReply, bool) {
+	start := time.Now()
+	ctx, span := h.startUpstream(ctx, "groq.SendMessage", req)
+	var usage chat.Usage
+	var err error
+	defer func() { endUpstream(span, usage, err) }()
+
+	h.debug(ctx, "sending request upstream", "messages", len(req.Messages), "max_tokens", req.MaxTokens, "n", req.N)
 	sse, cancel, err := h.groqClient.SendMessage(ctx, req)
 	if err != nil {
-		h.logger.Printf("failed to send message: %v", err)
+		h.upstreamError(ctx, err)
+		h.log(ctx).Printf("failed to send message: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+		return streamedReply{}, false
 	}
 
 	if cancel != nil {
 		defer cancel()
 	}
+	h.metrics.StreamStarted()
+	defer h.metrics.StreamEnded()
 
+	n := max(req.N, 1)
 	var conversationID string
-	var assistantResponse strings.Builder
+	reported := false
+	firstToken := false
+	assistantResponses := make([]strings.Builder, n)
+	finishReasons := make([]string, n)
+	chunks := chunkSpans{tracer: h.tracer, ctx: ctx}
+	defer chunks.end()
+	defer func() {
+		if reported {
+			h.recordUsage(ctx, req.Model, usage)
+		}
+	}()
 
 	for response := range sse {
 		if response.Error != nil {
-			h.logger.Printf("error in SSE stream: %v", response.Error)
+			err = response.Error
+			h.upstreamError(ctx, response.Error)
+			h.log(ctx).Printf("error in SSE stream: %v", response.Error)
 			// TODO: handle internal errors accordingly
 			http.Error(w, response.Error.Error(), http.StatusInternalServerError)
-			return
+			return streamedReply{}, false
 		}
 
 		if response.Response.ID == "" {
@@ -150,57 +382,234 @@ func (h *Handler) SendMessage(w http.ResponseWriter, r *http.Request) { // Reque
 
 		// capture the conversation ID from the response; since we're streaming the response
 		// we can't get it after the stream ends because the channel will be closed
+		if conversationID == "" {
+			// headers still go out with the first event
+			w.Header().Set("X-Conversation-ID", response.Response.ID)
+			logger.AddFields(ctx, "conversation_id", response.Response.ID)
+		}
 		conversationID = response.Response.ID
+		if u, ok := response.Response.StreamUsage(); ok {
+			usage, reported = u, true
+		}
 
-		if content := response.Response.Choices[0].Delta.Content; content != "" {
-			// Append the content to the assistant response
-			assistantResponse.WriteString(content)
+		for _, choice := range response.Response.Choices {
+			if choice.Index < 0 || choice.Index >= n {
+				continue
+			}
+			if choice.FinishReason != "" {
+				finishReasons[choice.Index] = choice.FinishReason
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			if !firstToken {
+				firstToken = true
+				h.firstToken(span, req.Model, time.Since(start))
+			}
+
+			// Append the content to the assistant response of that choice
+			assistantResponses[choice.Index].WriteString(choice.Delta.Content)
 
-			_, err = w.Write([]byte(content))
-			if err != nil {
-				h.logger.Printf("failed to write response: %v", err)
+			if err := writeEvent(w, choiceEvent(n, choice.Index), choice.Delta.Content); err != nil {
+				h.log(ctx).Printf("failed to write response: %v", err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				cancel()
-				return
+				return streamedReply{}, false
 			}
-			if f, ok := w.(http.Flusher); ok {
-				f.Flush()
+			chunks.written()
+			h.debug(ctx, "chunk sent", "choice", choice.Index, "content", choice.Delta.Content)
+		}
+	}
+
+	replies := make([]string, n)
+	for i := range assistantResponses {
+		replies[i] = assistantResponses[i].String()
+	}
+	return streamedReply{conversationID, replies, finishReasons, usage}, true
+}
+
+// completeMessage answers /chat with a single JSON body holding the whole completion.
+func (h *Handler) completeMessage(w http.ResponseWriter, r *http.Request, start time.Time, req chat.ChatRequest, body ChatRequestBody, validator *outputValidator) {
+	resp, err := h.completeChoice(r.Context(), req)
+	if err != nil {
+		h.log(r.Context()).Printf("failed to complete message: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// retries are only allowed with a single choice, see validate
+	attempt := 1
+	if validator != nil && body.RetryOnInvalid {
+		if result := validator.check(resp.Choices[0].Message.Content, 1); !result.Valid {
+			h.log(r.Context()).Printf("output of %s failed validation, retrying: %v", resp.ID, result.Errors)
+			h.metrics.Retry("validation")
+			req.Messages = append(req.Messages, retryMessages(resp.Choices[0].Message.Content, result)...)
+			if resp, err = h.completeChoice(r.Context(), req); err != nil {
+				h.log(r.Context()).Printf("failed to complete message: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
 			}
+			attempt = 2
+		}
+	}
+
+	choices := make([]ChoiceBody, 0, len(resp.Choices))
+	replies := make([]string, 0, len(resp.Choices))
+	completions := make([]audit.Completion, 0, len(resp.Choices))
+	for _, choice := range resp.Choices {
+		cb := ChoiceBody{
+			Index: choice.Index,
+			Message: ChatMessage{
+				Role:    string(choice.Message.Role),
+				Content: choice.Message.Content,
+			},
+			FinishReason: choice.FinishReason,
+		}
+		if validator != nil {
+			result := validator.check(choice.Message.Content, attempt)
+			result.Index = choice.Index
+			cb.Validation = &result
 		}
+		choices = append(choices, cb)
+		replies = append(replies, choice.Message.Content)
+		completions = append(completions, audit.Completion{Index: choice.Index, Content: choice.Message.Content, FinishReason: choice.FinishReason})
 	}
-	go h.persistMessages(conversationID, body.Messages, assistantResponse.String())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Conversation-ID", resp.ID)
+	logger.AddFields(r.Context(), "conversation_id", resp.ID)
+	w.WriteHeader(http.StatusOK)
+
+	response := ChatResponseBody{
+		ID:           resp.ID,
+		Message:      choices[0].Message,
+		FinishReason: choices[0].FinishReason,
+		Usage:        resp.Usage,
+		Cost:         h.costOf(req.Model, resp.Usage),
+		Validation:   choices[0].Validation,
+	}
+	if len(choices) > 1 {
+		response.Choices = choices
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log(r.Context()).Printf("failed to write response: %v", err)
+		return
+	}
+
+	h.auditExchange(r.Context(), "/chat", start, req, resp.ID, completions, resp.Usage)
+	h.persist(r.Context(), resp.ID, body.Messages, replies)
 }
 
-func (h *Handler) persistMessages(conversationID string, userMessages []ChatMessage, assistantReply string) {
+// completeChoice runs a non-streaming completion and makes sure it has at least
+// one choice, with the choices in the order of their index.
+func (h *Handler) completeChoice(ctx context.Context, req chat.ChatRequest) (*chat.ChatResponse, error) {
+	ctx, span := h.startUpstream(ctx, "groq.Complete", req)
+	resp, err := h.groqClient.Complete(ctx, req)
+	if err != nil {
+		endUpstream(span, chat.Usage{}, err)
+		h.upstreamError(ctx, err)
+		return nil, err
+	}
+	endUpstream(span, resp.Usage, nil)
+	h.recordUsage(ctx, req.Model, resp.Usage)
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("completion %s returned no choices", resp.ID)
+	}
+	choices, err := orderChoices(resp.Choices, max(req.N, 1))
+	if err != nil {
+		return nil, fmt.Errorf("completion %s: %w", resp.ID, err)
+	}
+	resp.Choices = choices
+	return resp, nil
+}
+
+// orderChoices places every choice at its index, like the demux of a stream.
+// Out of range or duplicate indices are rejected rather than leaving a gap.
+func orderChoices(choices []chat.Choice, n int) ([]chat.Choice, error) {
+	ordered := make([]chat.Choice, len(choices))
+	seen := make([]bool, len(choices))
+	for _, choice := range choices {
+		if choice.Index < 0 || choice.Index >= min(len(choices), n) {
+			return nil, fmt.Errorf("choice index %d out of range for %d choices", choice.Index, min(len(choices), n))
+		}
+		if seen[choice.Index] {
+			return nil, fmt.Errorf("duplicate choice index %d", choice.Index)
+		}
+		ordered[choice.Index], seen[choice.Index] = choice, true
+	}
+	return ordered, nil
+}
+
+// wantsStream reports whether the client asked for a streamed response.
+// Streaming is the default; it is turned off by `"stream": false` in the body
+// or by an Accept header that prefers JSON over event streams.
+func wantsStream(r *http.Request, body ChatRequestBody) bool {
+	if body.Stream != nil {
+		return *body.Stream
+	}
+
+	accept := r.Header.Get("Accept")
+	return !strings.Contains(accept, "application/json") || strings.Contains(accept, "text/event-stream")
+}
+
+// persistMessages saves the exchange. With several choices the first one is
+// stored as the reply and all of them are kept as alternates to pick from.
+func (h *Handler) persistMessages(ctx context.Context, owner, conversationID string, userMessages []ChatMessage, replies []string) {
 	for _, msg := range userMessages {
-		err := h.db.AppendMessage(conversationID, persistence.Message{
+		m := persistence.Message{
 			Role:    msg.Role,
 			Content: msg.Content,
+			Parts:   h.storeParts(ctx, owner, msg.Parts),
+		}
+		err := h.storeOp(ctx, "AppendMessage", conversationID, func() error {
+			return h.db.AppendMessage(owner, conversationID, m)
 		})
 		if err != nil {
-			h.logger.Printf("failed to save user message: %v", err)
+			h.log(ctx).Printf("failed to save user message: %v", err)
 		}
 	}
 
-	err := h.db.AppendMessage(conversationID, persistence.Message{
-		Role:    "assistant",
-		Content: assistantReply,
+	reply := persistence.Message{
+		Role: "assistant",
+	}
+	if len(replies) > 0 {
+		reply.Content = replies[0]
+	}
+	if len(replies) > 1 {
+		reply.Alternates = replies
+	}
+
+	err := h.storeOp(ctx, "AppendMessage", conversationID, func() error {
+		return h.db.AppendMessage(owner, conversationID, reply)
 	})
 	if err != nil {
-		h.logger.Printf("failed to save assistant response: %v", err)
+		h.log(ctx).Printf("failed to save assistant response: %v", err)
 	}
 
 	// Optional: log summary or most recent messages
-	messages, err := h.db.GetRecentMessages(conversationID, 20)
+	var messages []persistence.Message
+	err = h.storeOp(ctx, "GetRecentMessages", conversationID, func() (err error) {
+		messages, err = h.db.GetRecentMessages(owner, conversationID, 20)
+		return err
+	})
 	if err != nil {
-		h.logger.Printf("failed to fetch recent messages: %v", err)
+		h.log(ctx).Printf("failed to fetch recent messages: %v", err)
 		return
 	}
 	for _, msg := range messages {
-		h.logger.Printf("Message: %s, Role: %s", msg.Content, msg.Role)
+		h.log(ctx).Printf("Message: %s, Role: %s", msg.Content, msg.Role)
 	}
 }
 
+// hasSystemMessage reports whether the client sent its own system message.
+func hasSystemMessage(messages []ChatMessage) bool {
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			return true
+		}
+	}
+	return false
+}
+
 // add the message to the request
 func addMessageToRequest(req *chat.ChatRequest, msg ChatMessage) error {
 	switch msg.Role {
@@ -208,16 +617,19 @@ func addMessageToRequest(req *chat.ChatRequest, msg ChatMessage) error {
 		req.Messages = append(req.Messages, chat.Message{
 			Role:    chat.MessageRoleUser,
 			Content: msg.Content,
+			Parts:   msg.Parts,
 		})
 	case "assistant":
 		req.Messages = append(req.Messages, chat.Message{
 			Role:    chat.MessageRoleAssistant,
 			Content: msg.Content,
+			Parts:   msg.Parts,
 		})
 	case "system":
 		req.Messages = append(req.Messages, chat.Message{
 			Role:    chat.MessageRoleSystem,
 			Content: msg.Content,
+			Parts:   msg.Parts,
 		})
 	default:
 		return fmt.Errorf("invalid message role: %s", msg.Role)
@@ -241,6 +653,52 @@ func (h *Handler) Status(w http.ResponseWriter, r *http.Request) {
 
 	response := map[string]string{"status": "OK"}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		h.logger.Printf("failed to write response: %v", err)
+		h.log(r.Context()).Printf("failed to write response: %v", err)
+	}
+}
+
+type SelectChoiceBody struct {
+	Index int `json:"index"`
+}
+
+// SelectChoice handles the POST /conversations/{id}/choice endpoint.
+//
+//	@Summary		Pick one of the generated choices.
+//	@Description	When several choices were generated (n > 1), makes the choice at `index` the reply stored in the conversation.
+//	@Tags			chat
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string				true	"Conversation ID"
+//	@Param			body	body		SelectChoiceBody	true	"Choice to select"
+//	@Success		200		{object}	persistence.Message	"The updated assistant message"
+//	@Failure		400		{string}	string				"Bad Request"
+//	@Failure		404		{string}	string				"Not Found"
+//	@Router			/conversations/{id}/choice [post]
+func (h *Handler) SelectChoice(w http.ResponseWriter, r *http.Request) {
+	var body SelectChoiceBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.log(r.Context()).Printf("failed to decode request body: %v", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	var msg persistence.Message
+	err := h.storeOp(r.Context(), "SelectAlternate", r.PathValue("id"), func() (err error) {
+		msg, err = h.db.SelectAlternate(ownerOf(r.Context()), r.PathValue("id"), body.Index)
+		return err
+	})
+	switch {
+	case errors.Is(err, persistence.ErrConversationNotFound), errors.Is(err, persistence.ErrNoAlternate):
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	case err != nil:
+		h.log(r.Context()).Printf("failed to select choice: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(msg); err != nil {
+		h.log(r.Context()).Printf("failed to write response: %v", err)
 	}
 }
@@ -8,26 +8,38 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"stream/internal/chat"
+	"stream/internal/config"
 	"stream/internal/persistence"
 	"stream/pkg/logger"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 type mockGroqClient struct {
 	SendMessageFn func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error)
+	CompleteFn    func(ctx context.Context, req chat.ChatRequest) (*chat.ChatResponse, error)
 }
 
 func (m *mockGroqClient) SendMessage(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
 	return m.SendMessageFn(ctx, req)
 }
 
+func (m *mockGroqClient) Complete(ctx context.Context, req chat.ChatRequest) (*chat.ChatResponse, error) {
+	return m.CompleteFn(ctx, req)
+}
+
+// testConfig returns the default configuration changed by change.
+func testConfig(change func(*config.Config)) *config.Live {
+	cfg := config.Defaults()
+	change(&cfg)
+	return config.NewLive(logger.Info, cfg, nil)
+}
+
 func TestSendMessage_Success(t *testing.T) {
 	l := logger.NewStdLogger(log.Default())
-	_ = os.Setenv("MAX_TOKENS", "32")
 
 	stream := make(chan *chat.ChatStreamResponse)
 	go func() {
@@ -80,8 +92,6 @@ func TestSendMessage_InvalidJSON(t *testing.T) {
 		logger: l,
 	}
 
-	_ = os.Setenv("MAX_TOKENS", "32")
-
 	req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBuffer([]byte("{invalid json")))
 	w := httptest.NewRecorder()
 
@@ -94,23 +104,96 @@ func TestSendMessage_InvalidJSON(t *testing.T) {
 	}
 }
 
-func TestSendMessage_MissingMaxTokens(t *testing.T) {
+func TestSendMessage_DefaultMaxTokens(t *testing.T) {
 	l := logger.NewStdLogger(log.Default())
+
+	var sent chat.ChatRequest
+	mockClient := &mockGroqClient{
+		CompleteFn: func(ctx context.Context, req chat.ChatRequest) (*chat.ChatResponse, error) {
+			sent = req
+			return &chat.ChatResponse{ID: "some-id", Choices: []chat.Choice{{Message: chat.Message{Role: "assistant", Content: "Hi"}}}}, nil
+		},
+	}
+
 	server := &Handler{
-		logger: l,
+		groqClient: mockClient,
+		logger:     l,
+		db:         persistence.NewInMemoryStore(),
+		cfg:        testConfig(func(c *config.Config) { c.MaxTokens = 32 }),
 	}
 
-	_ = os.Unsetenv("MAX_TOKENS")
+	send := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		server.SendMessage(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+	}
 
-	req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBuffer([]byte("{}")))
-	w := httptest.NewRecorder()
+	send(`{"messages":[{"role":"user","content":"Hello"}],"stream":false}`)
+	if sent.MaxTokens != 32 {
+		t.Fatalf("expected the configured max_tokens of 32, got %d", sent.MaxTokens)
+	}
 
-	server.SendMessage(w, req)
-	res := w.Result()
-	defer res.Body.Close()
+	send(`{"messages":[{"role":"user","content":"Hello"}],"stream":false,"max_tokens":8}`)
+	if sent.MaxTokens != 8 {
+		t.Fatalf("expected the requested max_tokens of 8, got %d", sent.MaxTokens)
+	}
+}
+
+func TestSendMessage_ReloadedSettings(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
 
-	if res.StatusCode != http.StatusInternalServerError {
-		t.Fatalf("expected status 500, got %d", res.StatusCode)
+	var sent chat.ChatRequest
+	mockClient := &mockGroqClient{
+		CompleteFn: func(ctx context.Context, req chat.ChatRequest) (*chat.ChatResponse, error) {
+			sent = req
+			return &chat.ChatResponse{ID: "some-id", Choices: []chat.Choice{{Message: chat.Message{Role: "assistant", Content: "Hi"}}}}, nil
+		},
+	}
+
+	reloaded := config.Defaults()
+	reloaded.DefaultModel = string(chat.ModelIDMIXTRAL)
+	reloaded.SystemPrompt = "Answer in French."
+	live := config.NewLive(logger.Info, config.Defaults(), func() (config.Config, error) { return reloaded, nil })
+
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     l,
+		db:         persistence.NewInMemoryStore(),
+		cfg:        live,
+	}
+
+	send := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		server.SendMessage(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+	}
+
+	send(`{"messages":[{"role":"user","content":"Hello"}],"stream":false}`)
+	if sent.Model != chat.ModelIDLLAMA38B || len(sent.Messages) != 1 {
+		t.Fatalf("expected the default model without a system prompt, got %s with %d messages", sent.Model, len(sent.Messages))
+	}
+
+	if _, err := live.Reload(); err != nil {
+		t.Fatalf("Reload returned error: %v", err)
+	}
+
+	send(`{"messages":[{"role":"user","content":"Hello"}],"stream":false}`)
+	if sent.Model != chat.ModelIDMIXTRAL {
+		t.Fatalf("expected the reloaded default model, got %s", sent.Model)
+	}
+	if len(sent.Messages) != 2 || sent.Messages[0].Role != chat.MessageRoleSystem || sent.Messages[0].Content != "Answer in French." {
+		t.Fatalf("expected the system prompt to come first, got %+v", sent.Messages)
+	}
+
+	send(`{"messages":[{"role":"system","content":"Be terse."},{"role":"user","content":"Hello"}],"stream":false}`)
+	if len(sent.Messages) != 2 || sent.Messages[0].Content != "Be terse." {
+		t.Fatalf("expected the client's system message to replace the prompt, got %+v", sent.Messages)
 	}
 }
 
@@ -120,8 +203,6 @@ func TestSendMessage_InvalidRole(t *testing.T) {
 		logger: l,
 	}
 
-	_ = os.Setenv("MAX_TOKENS", "32")
-
 	body := ChatRequestBody{
 		Messages: []ChatMessage{{Role: "unknown", Content: "???"}},
 		Model:    chat.ModelIDLLAMA38B,
@@ -141,7 +222,6 @@ func TestSendMessage_InvalidRole(t *testing.T) {
 
 func TestConcurrentSendMessage(t *testing.T) {
 	l := logger.NewStdLogger(log.Default())
-	_ = os.Setenv("MAX_TOKENS", "32")
 
 	mockClient := &mockGroqClient{
 		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
@@ -196,7 +276,6 @@ func TestConcurrentSendMessage(t *testing.T) {
 
 func TestSendMessage_SaveConversation(t *testing.T) {
 	l := logger.NewStdLogger(log.Default())
-	_ = os.Setenv("MAX_TOKENS", "32")
 
 	mockClient := &mockGroqClient{
 		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
@@ -244,3 +323,203 @@ func TestSendMessage_SaveConversation(t *testing.T) {
 
 	// Here you would typically check if the conversation was saved in the database.
 }
+
+func TestSendMessage_NonStreaming(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+
+	mockClient := &mockGroqClient{
+		CompleteFn: func(ctx context.Context, req chat.ChatRequest) (*chat.ChatResponse, error) {
+			if req.Stream {
+				t.Errorf("expected a non-streaming request")
+			}
+			return &chat.ChatResponse{
+				ID: "some-id",
+				Choices: []chat.Choice{{
+					Message:      chat.Message{Role: chat.MessageRoleAssistant, Content: "Hello there"},
+					FinishReason: "stop",
+				}},
+				Usage: chat.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5},
+			}, nil
+		},
+	}
+
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     l,
+		db:         persistence.NewInMemoryStore(),
+	}
+
+	streamOff := false
+	tests := []struct {
+		name   string
+		body   ChatRequestBody
+		accept string
+	}{
+		{"stream false", ChatRequestBody{Messages: []ChatMessage{{Role: "user", Content: "Hello"}}, Stream: &streamOff}, ""},
+		{"accept json", ChatRequestBody{Messages: []ChatMessage{{Role: "user", Content: "Hello"}}}, "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBody, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBuffer(jsonBody))
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			server.SendMessage(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", res.StatusCode)
+			}
+			if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("expected JSON content type, got %q", ct)
+			}
+
+			var got ChatResponseBody
+			if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if got.Message.Content != "Hello there" || got.FinishReason != "stop" || got.Usage.TotalTokens != 5 {
+				t.Fatalf("unexpected response: %+v", got)
+			}
+		})
+	}
+}
+
+func TestSendMessage_NonStreamingChoiceOrder(t *testing.T) {
+	var choices []chat.Choice
+	mockClient := &mockGroqClient{
+		CompleteFn: func(ctx context.Context, req chat.ChatRequest) (*chat.ChatResponse, error) {
+			return &chat.ChatResponse{ID: "order-id", Choices: choices}, nil
+		},
+	}
+	db := persistence.NewInMemoryStore()
+	server := &Handler{groqClient: mockClient, logger: logger.NewStdLogger(log.Default()), db: db}
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(`{"messages":[{"role":"user","content":"Greet me"}],"n":2,"stream":false}`))
+		w := httptest.NewRecorder()
+		server.SendMessage(w, req)
+		return w
+	}
+	reply := func(index int, content string) chat.Choice {
+		return chat.Choice{Index: index, Message: chat.Message{Role: chat.MessageRoleAssistant, Content: content}}
+	}
+
+	// upstream may list the choices in any order
+	choices = []chat.Choice{reply(1, "Good day"), reply(0, "Hello")}
+	w := send()
+	var got ChatResponseBody
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d, %v; want 200", w.Code, err)
+	}
+	if got.Message.Content != "Hello" || len(got.Choices) != 2 || got.Choices[1].Index != 1 || got.Choices[1].Message.Content != "Good day" {
+		t.Fatalf("expected the choices by index, got %+v", got)
+	}
+	var stored []persistence.Message
+	for i := 0; i < 50 && len(stored) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		stored, _ = db.GetRecentMessages("", "order-id", 20)
+	}
+	if len(stored) != 2 || stored[1].Content != "Hello" || len(stored[1].Alternates) != 2 || stored[1].Alternates[1] != "Good day" {
+		t.Fatalf("expected the replies stored by index, got %+v", stored)
+	}
+
+	for name, bad := range map[string][]chat.Choice{
+		"duplicate":    {reply(0, "Hello"), reply(0, "Good day")},
+		"out of range": {reply(0, "Hello"), reply(2, "Good day")},
+		"negative":     {reply(-1, "Hello"), reply(0, "Good day")},
+	} {
+		choices = bad
+		if w := send(); w.Code != http.StatusInternalServerError {
+			t.Errorf("%s indices got %d; want 500", name, w.Code)
+		}
+	}
+}
+
+func TestSendMessage_MultipleChoices(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+
+	mockClient := &mockGroqClient{
+		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
+			if req.N != 2 {
+				t.Errorf("expected n=2 to be forwarded, got %d", req.N)
+			}
+			stream := make(chan *chat.ChatStreamResponse)
+			go func() {
+				defer close(stream)
+				for _, delta := range []chat.Choice{
+					{Index: 0, Delta: chat.Message{Content: "Hel"}},
+					{Index: 1, Delta: chat.Message{Content: "Good "}},
+					{Index: 0, Delta: chat.Message{Content: "lo"}},
+					{Index: 1, Delta: chat.Message{Content: "day"}},
+					{Index: 7, Delta: chat.Message{Content: "ignored"}},
+				} {
+					stream <- &chat.ChatStreamResponse{
+						Response: chat.ChatResponse{ID: "multi-id", Choices: []chat.Choice{delta}},
+					}
+				}
+				// a chunk without choices must not break the stream
+				stream <- &chat.ChatStreamResponse{Response: chat.ChatResponse{ID: "multi-id"}}
+			}()
+			return stream, func() {}, nil
+		},
+	}
+
+	db := persistence.NewInMemoryStore()
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     l,
+		db:         db,
+	}
+
+	jsonBody := []byte(`{"messages":[{"role":"user","content":"Greet me"}],"n":2}`)
+	req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	server.SendMessage(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+
+	responseBody, _ := io.ReadAll(res.Body)
+	want := "event: choice-0\ndata: Hel\n\n" +
+		"event: choice-1\ndata: Good \n\n" +
+		"event: choice-0\ndata: lo\n\n" +
+		"event: choice-1\ndata: day\n\n"
+	if string(responseBody) != want {
+		t.Fatalf("unexpected stream:\n got: %q\nwant: %q", responseBody, want)
+	}
+
+	var stored []persistence.Message
+	for i := 0; i < 50 && len(stored) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		stored, _ = db.GetRecentMessages("", "multi-id", 20)
+	}
+	if len(stored) != 2 || stored[1].Content != "Hello" || len(stored[1].Alternates) != 2 || stored[1].Alternates[1] != "Good day" {
+		t.Fatalf("expected both choices to be stored, got %+v", stored)
+	}
+
+	selectReq := httptest.NewRequest(http.MethodPost, "/conversations/multi-id/choice", strings.NewReader(`{"index":1}`))
+	selectReq.SetPathValue("id", "multi-id")
+	selectW := httptest.NewRecorder()
+	server.SelectChoice(selectW, selectReq)
+
+	if selectW.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", selectW.Code)
+	}
+	stored, _ = db.GetRecentMessages("", "multi-id", 20)
+	if stored[1].Content != "Good day" || stored[1].Selected != 1 {
+		t.Fatalf("expected the second choice to be selected, got %+v", stored[1])
+	}
+
+	selectReq = httptest.NewRequest(http.MethodPost, "/conversations/multi-id/choice", strings.NewReader(`{"index":5}`))
+	selectReq.SetPathValue("id", "multi-id")
+	selectW = httptest.NewRecorder()
+	server.SelectChoice(selectW, selectReq)
+
+	if selectW.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for a missing choice, got %d", selectW.Code)
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"stream/internal/persistence"
+	"sync"
+	"time"
+)
+
+// CheckResult is the outcome of one readiness check.
+type CheckResult struct {
+	Status    string     `json:"status"` // "ok" or "fail"
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"` // When a cached result was obtained
+}
+
+// HealthBody is returned by /healthz and /readyz.
+type HealthBody struct {
+	Status string                 `json:"status"` // "ok", or "degraded" when a check failed
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+func checkResult(err error) CheckResult {
+	if err != nil {
+		return CheckResult{Status: "fail", Error: err.Error()}
+	}
+	return CheckResult{Status: "ok"}
+}
+
+// pinger is implemented by dependencies that can check they are reachable.
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// upstreamProbe caches the outcome of pinging the model provider, so that
+// frequent readiness checks don't each send a request upstream.
+type upstreamProbe struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+func (p *upstreamProbe) check(ctx context.Context, client any, ttl time.Duration) CheckResult {
+	c, ok := client.(pinger)
+	if !ok {
+		return CheckResult{Status: "ok"}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.checkedAt.IsZero() || time.Since(p.checkedAt) >= ttl {
+		p.err = c.Ping(ctx)
+		p.checkedAt = time.Now()
+	}
+	result := checkResult(p.err)
+	checkedAt := p.checkedAt
+	result.CheckedAt = &checkedAt
+	return result
+}
+
+// Healthz handles the GET /healthz endpoint.
+//
+//	@Summary		Liveness probe.
+//	@Description	Returns 200 as long as the server is able to serve requests; it checks no dependency.
+//	@Tags			status
+//	@Produce		json
+//	@Success		200	{object}	HealthBody	"Server is alive"
+//	@Router			/healthz [get]
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	h.writeHealth(w, r, HealthBody{Status: "ok"})
+}
+
+// Readyz handles the GET /readyz endpoint.
+//
+//	@Summary		Readiness probe.
+//	@Description	Checks that the configuration is loaded, the Groq API key is set and the store can be reached,
+//	@Description	and with READINESS_PROBE_UPSTREAM that the Groq API can be reached. Returns 503 when any check fails,
+//	@Description	and from the start of a shutdown on.
+//	@Tags			status
+//	@Produce		json
+//	@Success		200	{object}	HealthBody	"Ready to serve traffic"
+//	@Failure		503	{object}	HealthBody	"A dependency is failing"
+//	@Router			/readyz [get]
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	cfg := h.settings()
+	checks := make(map[string]CheckResult)
+
+	if h.cfg == nil {
+		checks["config"] = CheckResult{Status: "fail", Error: "configuration not loaded"}
+	} else {
+		checks["config"] = CheckResult{Status: "ok"}
+	}
+
+	if cfg.GroqAPIKey.Reveal() == "" {
+		checks["api_key"] = CheckResult{Status: "fail", Error: "GROQ_API_KEY is not set"}
+	} else {
+		checks["api_key"] = CheckResult{Status: "ok"}
+	}
+
+	if h.drain.isDraining() {
+		checks["shutdown"] = CheckResult{Status: "fail", Error: errShutdown.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.Readiness.Timeout)
+	defer cancel()
+	checks["store"] = checkResult(persistence.Ping(ctx, h.db))
+	if cfg.Readiness.ProbeUpstream {
+		checks["upstream"] = h.upstream.check(ctx, h.groqClient, cfg.Readiness.UpstreamTTL)
+	}
+
+	body := HealthBody{Status: "ok", Checks: checks}
+	for name, c := range checks {
+		if c.Status != "ok" {
+			body.Status = "degraded"
+			h.log(r.Context()).Printf("readiness check %s failed: %s", name, c.Error)
+		}
+	}
+	h.writeHealth(w, r, body)
+}
+
+func (h *Handler) writeHealth(w http.ResponseWriter, r *http.Request, body HealthBody) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if body.Status == "ok" {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.log(r.Context()).Printf("failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/config"
+	"stream/internal/persistence"
+	"stream/pkg/logger"
+	"testing"
+	"time"
+)
+
+// pingingClient is a chat client whose reachability can be checked.
+type pingingClient struct {
+	mockGroqClient
+	err   error
+	pings int
+}
+
+func (c *pingingClient) Ping(ctx context.Context) error {
+	c.pings++
+	return c.err
+}
+
+func TestHealthz(t *testing.T) {
+	server := &Handler{logger: logger.NewStdLogger(log.Default())}
+
+	w := httptest.NewRecorder()
+	server.Healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK || w.Body.String() != "{\"status\":\"ok\"}\n" {
+		t.Errorf("got %d %s; want 200 and an ok status", w.Code, w.Body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	client := &pingingClient{}
+	server := &Handler{
+		logger:     logger.NewStdLogger(log.Default()),
+		groqClient: client,
+		db:         persistence.NewInMemoryStore(),
+		cfg: testConfig(func(c *config.Config) {
+			c.GroqAPIKey = "key"
+			c.Readiness.ProbeUpstream = true
+			c.Readiness.UpstreamTTL = time.Hour
+		}),
+	}
+
+	ready := func() (int, HealthBody) {
+		w := httptest.NewRecorder()
+		server.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body HealthBody
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return w.Code, body
+	}
+
+	code, body := ready()
+	if code != http.StatusOK || body.Status != "ok" {
+		t.Errorf("got %d %+v; want 200 and an ok status", code, body)
+	}
+	for _, name := range []string{"config", "api_key", "store", "upstream"} {
+		if body.Checks[name].Status != "ok" {
+			t.Errorf("check %s = %+v; want ok", name, body.Checks[name])
+		}
+	}
+
+	// the upstream result is cached, so a failure shows after the TTL only
+	client.err = errors.New("connection refused")
+	if code, _ := ready(); code != http.StatusOK || client.pings != 1 {
+		t.Errorf("got %d after %d pings; want the cached result of 1 ping", code, client.pings)
+	}
+	server.upstream.checkedAt = time.Now().Add(-2 * time.Hour)
+	code, body = ready()
+	if code != http.StatusServiceUnavailable || body.Status != "degraded" {
+		t.Errorf("got %d %+v; want 503 and a degraded status", code, body)
+	}
+	if up := body.Checks["upstream"]; up.Status != "fail" || up.Error != "connection refused" || up.CheckedAt == nil {
+		t.Errorf("upstream check = %+v; want the failure", up)
+	}
+}
+
+func TestReadyz_MissingAPIKey(t *testing.T) {
+	server := &Handler{
+		logger:     logger.NewStdLogger(log.Default()),
+		groqClient: &pingingClient{},
+		db:         persistence.NewInMemoryStore(),
+		cfg:        testConfig(func(c *config.Config) {}),
+	}
+
+	w := httptest.NewRecorder()
+	server.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var body HealthBody
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusServiceUnavailable || body.Checks["api_key"].Status != "fail" {
+		t.Errorf("got %d %+v; want 503 and a failed api_key check", w.Code, body)
+	}
+	if _, ok := body.Checks["upstream"]; ok {
+		t.Error("upstream was checked without READINESS_PROBE_UPSTREAM")
+	}
+}
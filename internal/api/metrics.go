@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"stream/internal/chat"
+	"stream/internal/metrics"
+	"time"
+)
+
+// Instrument returns a middleware that counts requests and their latency by
+// route pattern and status. It must wrap the *http.ServeMux directly, which
+// records the pattern a request matched on the request itself.
+func Instrument(m *metrics.Metrics) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			wrapped := &wrappedWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+
+			next.ServeHTTP(wrapped, r)
+
+			m.ObserveRequest(r.Pattern, r.Method, wrapped.statusCode, time.Since(start))
+		})
+	}
+}
+
+// upstreamError counts a failed request to the model provider. Requests the
+// client gave up on are not the provider's fault and aren't counted.
+func (h *Handler) upstreamError(ctx context.Context, err error) {
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		return
+	}
+	h.metrics.UpstreamError(upstreamErrorType(err))
+}
+
+// upstreamErrorType classifies an error of the chat client for metrics.
+func upstreamErrorType(err error) string {
+	var apiErr *chat.APIError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr):
+		return "http_" + strconv.Itoa(apiErr.StatusCode)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/chat"
+	"stream/internal/metrics"
+	"stream/internal/persistence"
+	"stream/pkg/logger"
+	"strings"
+	"testing"
+)
+
+func TestInstrument(t *testing.T) {
+	m := metrics.New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /images/{ref}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := Instrument(m)(mux)
+
+	for _, path := range []string{"/images/a", "/images/b", "/nowhere"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := m.Requests.Value("GET /images/{ref}", "GET", "404"); got != 2 {
+		t.Errorf("requests by pattern = %v; want 2", got)
+	}
+	if got := m.Requests.Value("unmatched", "GET", "404"); got != 1 {
+		t.Errorf("unmatched requests = %v; want 1", got)
+	}
+	if got := m.RequestDuration.Count("GET /images/{ref}", "GET"); got != 2 {
+		t.Errorf("duration observations = %v; want 2", got)
+	}
+
+	w := httptest.NewRecorder()
+	m.Registry.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `http_requests_total{route="GET /images/{ref}",method="GET",status="404"} 2`) {
+		t.Errorf("exposition is missing the request counter:\n%s", w.Body.String())
+	}
+}
+
+func TestSendMessage_Metrics(t *testing.T) {
+	m := metrics.New()
+	fail := false
+	mockClient := &mockGroqClient{
+		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
+			if fail {
+				return nil, nil, &chat.APIError{StatusCode: http.StatusServiceUnavailable}
+			}
+			stream := make(chan *chat.ChatStreamResponse, 2)
+			stream <- &chat.ChatStreamResponse{Response: chat.ChatResponse{ID: "some-id", Choices: []chat.Choice{{Delta: chat.Message{Content: "Hello"}}}}}
+			stream <- &chat.ChatStreamResponse{Error: errors.New("connection reset")}
+			close(stream)
+			return stream, func() {}, nil
+		},
+	}
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     logger.NewStdLogger(log.Default()),
+		db:         persistence.NewInMemoryStore(),
+		metrics:    m,
+	}
+
+	send := func() {
+		req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBufferString(`{"messages":[{"role":"user","content":"Hello"}]}`))
+		server.SendMessage(httptest.NewRecorder(), req)
+	}
+
+	send()
+	if got := m.TimeToFirstToken.Count(string(chat.ModelIDLLAMA38B)); got != 1 {
+		t.Errorf("time to first token observations = %d; want 1", got)
+	}
+	if got := m.UpstreamErrors.Value("other"); got != 1 {
+		t.Errorf("stream errors = %v; want 1", got)
+	}
+	if got := m.ActiveStreams.Value(); got != 0 {
+		t.Errorf("active streams = %v; want 0 once the stream is over", got)
+	}
+
+	fail = true
+	send()
+	if got := m.UpstreamErrors.Value("http_503"); got != 1 {
+		t.Errorf("upstream 503 errors = %v; want 1", got)
+	}
+}
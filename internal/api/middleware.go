@@ -1,11 +1,18 @@
 package api
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
+	"stream/internal/tracing"
 	"stream/pkg/logger"
 	"time"
 )
 
+// maxRequestIDLength caps the X-Request-ID accepted from clients.
+const maxRequestIDLength = 128
+
 // Middleware represents the type signature of a middleware
 // function.
 type Middleware func(http.Handler) http.Handler
@@ -30,23 +37,83 @@ func (w *wrappedWriter) Flush() {
 	}
 }
 
-func Logging(logger logger.Logger, next http.Handler) http.Handler {
+// Unwrap lets http.ResponseController reach the writer of the connection.
+func (w *wrappedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Logging logs every request once it is served. It takes the request ID from
+// the X-Request-ID header, or makes one up, and echoes it in the response.
+// The request context carries a logger that adds the request ID, and the
+// trace ID of a W3C traceparent header, to every line logged for the request;
+// see requestLogger.
+func Logging(l logger.Logger, next http.Handler) http.Handler {
+	base := logger.Adapt(l)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		fields := []any{"request_id", id, "method", r.Method, "path", r.URL.Path}
+		if sc, ok := tracing.ParseTraceparent(r.Header.Get("traceparent")); ok {
+			fields = append(fields, "trace_id", sc.TraceID.String())
+		}
+		ctx := logger.NewContext(r.Context(), base.With(fields...))
+		ctx = context.WithValue(ctx, requestIDKey{}, id)
+
 		wrapped := &wrappedWriter{
 			ResponseWriter: w,
 			statusCode:     http.StatusOK,
 		}
 
-		next.ServeHTTP(wrapped, r)
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
 
-		logger.Printf("%s %s %d %s %s",
-			r.Method,
-			r.URL.Path,
-			wrapped.statusCode,
-			time.Since(start),
-			r.RemoteAddr,
+		rl, _ := logger.FromContext(ctx)
+		rl.Info("request served",
+			"status", wrapped.statusCode,
+			"duration", time.Since(start),
+			"remote_addr", r.RemoteAddr,
 		)
 	})
 }
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID Logging gave the request of ctx.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger returns the logger of the request ctx belongs to, or
+// fallback outside of a request.
+func requestLogger(ctx context.Context, fallback logger.Logger) logger.Logger {
+	if l, ok := logger.FromContext(ctx); ok {
+		return l
+	}
+	return fallback
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts IDs of visible ASCII characters, so that client
+// supplied IDs can't forge log lines or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
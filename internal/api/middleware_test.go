@@ -1,6 +1,8 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"stream/pkg/logger"
@@ -38,3 +40,47 @@ func TestLoggingMiddleware(t *testing.T) {
 		t.Fatalf("log output missing expected content: %s", logOutput)
 	}
 }
+
+func TestLogging_RequestID(t *testing.T) {
+	var buf bytes.Buffer
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.AddFields(r.Context(), "user", "alice")
+		requestLogger(r.Context(), logger.Info).Printf("handling")
+	})
+	wrapped := Logging(logger.NewJSON(&buf), handler)
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	wrapped.ServeHTTP(w, req)
+
+	if got := w.Header().Get("X-Request-ID"); got != "req-123" {
+		t.Fatalf("expected the request ID to be echoed, got %q", got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %q", buf.String())
+	}
+	for _, line := range lines {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		for key, want := range map[string]any{"request_id": "req-123", "trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "path": "/test", "user": "alice"} {
+			if entry[key] != want {
+				t.Errorf("%s = %v in %s; want %v", key, entry[key], entry["msg"], want)
+			}
+		}
+	}
+
+	// IDs that could forge log lines are replaced
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("X-Request-ID", "evil\nid")
+	w = httptest.NewRecorder()
+	wrapped.ServeHTTP(w, req)
+	if got := w.Header().Get("X-Request-ID"); len(got) != 32 {
+		t.Fatalf("expected a generated request ID, got %q", got)
+	}
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"stream/internal/chat"
+	"stream/internal/persistence"
+	"strings"
+)
+
+// Limits for image content parts.
+const (
+	maxImagesPerRequest = 5
+	maxImageBytes       = 4 << 20
+)
+
+var allowedImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+	"image/gif":  true,
+}
+
+// chatMessageJSON is the wire representation of ChatMessage.
+type chatMessageJSON struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	content, err := chat.MarshalContent(m.Content, m.Parts)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(chatMessageJSON{Role: m.Role, Content: content})
+}
+
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	var raw chatMessageJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	text, parts, err := chat.UnmarshalContent(raw.Content)
+	if err != nil {
+		return err
+	}
+
+	*m = ChatMessage{Role: raw.Role, Content: text, Parts: parts}
+	return nil
+}
+
+// parseDataURL decodes a base64 data URL into its media type and bytes.
+func parseDataURL(u string) (string, []byte, error) {
+	rest, ok := strings.CutPrefix(u, "data:")
+	if !ok {
+		return "", nil, errors.New("not a data URL")
+	}
+	meta, payload, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", nil, errors.New("malformed data URL")
+	}
+	mediaType, ok := strings.CutSuffix(meta, ";base64")
+	if !ok {
+		return "", nil, errors.New("data URL must be base64 encoded")
+	}
+	if base64.StdEncoding.DecodedLen(len(payload)) > maxImageBytes+2 {
+		return "", nil, fmt.Errorf("image must be at most %d bytes", maxImageBytes)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid base64 image data: %v", err)
+	}
+	if len(data) > maxImageBytes {
+		return "", nil, fmt.Errorf("image must be at most %d bytes", maxImageBytes)
+	}
+	return mediaType, data, nil
+}
+
+// validateParts checks the content parts of every message: part types, image
+// URLs, media types and sizes, and whether the model can see images at all.
+func validateParts(messages []ChatMessage, model chat.ModelID, verr *ValidationError) {
+	limits, _ := model.Limits()
+
+	images := 0
+	for i, msg := range messages {
+		for j, part := range msg.Parts {
+			field := fmt.Sprintf("messages[%d].content[%d]", i, j)
+
+			switch part.Type {
+			case chat.ContentPartText:
+				continue
+			case chat.ContentPartImageURL:
+			default:
+				verr.add(field+".type", "must be %q or %q, got %q", chat.ContentPartText, chat.ContentPartImageURL, part.Type)
+				continue
+			}
+
+			images++
+			if msg.Role != "user" {
+				verr.add(field, "images are only allowed in user messages")
+			}
+			if !limits.Vision {
+				verr.add(field, "model %s does not accept images", model)
+			}
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				verr.add(field+".image_url.url", "is required")
+				continue
+			}
+			if err := validateImageURL(part.ImageURL.URL); err != nil {
+				verr.add(field+".image_url.url", "%v", err)
+			}
+		}
+	}
+
+	if images > maxImagesPerRequest {
+		verr.add("messages", "must contain at most %d images, got %d", maxImagesPerRequest, images)
+	}
+}
+
+func validateImageURL(u string) error {
+	if strings.HasPrefix(u, "data:") {
+		mediaType, _, err := parseDataURL(u)
+		if err != nil {
+			return err
+		}
+		if !allowedImageTypes[mediaType] {
+			return fmt.Errorf("unsupported image type %q", mediaType)
+		}
+		return nil
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("must be an http(s) URL or a base64 data URL")
+	}
+	return nil
+}
+
+// storeParts converts content parts for persistence, moving inline images
+// into the image store so the conversation only keeps their references.
+func (h *Handler) storeParts(ctx context.Context, owner string, parts []chat.ContentPart) []persistence.ContentPart {
+	if len(parts) == 0 {
+		return nil
+	}
+
+	stored := make([]persistence.ContentPart, 0, len(parts))
+	for _, part := range parts {
+		if part.Type != chat.ContentPartImageURL || part.ImageURL == nil {
+			stored = append(stored, persistence.ContentPart{Type: string(part.Type), Text: part.Text})
+			continue
+		}
+
+		u := part.ImageURL.URL
+		if !strings.HasPrefix(u, "data:") {
+			stored = append(stored, persistence.ContentPart{Type: string(part.Type), ImageURL: u})
+			continue
+		}
+
+		if h.images == nil {
+			h.log(ctx).Printf("no image store configured, dropping uploaded image")
+			continue
+		}
+		mediaType, data, err := parseDataURL(u)
+		if err != nil {
+			h.log(ctx).Printf("failed to decode uploaded image: %v", err)
+			continue
+		}
+		ref, err := h.images.PutImage(owner, data, mediaType)
+		if err != nil {
+			h.log(ctx).Printf("failed to save uploaded image: %v", err)
+			continue
+		}
+		stored = append(stored, persistence.ContentPart{Type: string(part.Type), ImageRef: ref})
+	}
+	return stored
+}
+
+// GetImage handles the GET /images/{ref} endpoint.
+//
+//	@Summary		Fetch an uploaded image.
+//	@Description	Returns an image the caller uploaded inline in a chat message, by the reference stored in the conversation.
+//	@Description	Images of other users are not found, and neither are the least recently used ones once IMAGE_STORE_MAX_MB is reached.
+//	@Tags			chat
+//	@Produce		image/png,image/jpeg,image/webp,image/gif
+//	@Param			ref	path		string	true	"Image reference"
+//	@Success		200	{file}		binary	"The image"
+//	@Failure		404	{string}	string	"Not Found"
+//	@Router			/images/{ref} [get]
+func (h *Handler) GetImage(w http.ResponseWriter, r *http.Request) {
+	if h.images == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	data, mediaType, err := h.images.GetImage(ownerOf(r.Context()), r.PathValue("ref"))
+	if err != nil {
+		if !errors.Is(err, persistence.ErrImageNotFound) {
+			h.log(r.Context()).Printf("failed to load image: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	// the media type came from the client: anything but the image types
+	// accepted on upload is served as a download browsers won't render
+	disposition := "inline"
+	if !allowedImageTypes[mediaType] {
+		mediaType, disposition = "application/octet-stream", "attachment"
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	if _, err := w.Write(data); err != nil {
+		h.log(r.Context()).Printf("failed to write response: %v", err)
+	}
+}
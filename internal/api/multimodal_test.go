@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/chat"
+	"stream/internal/persistence"
+	"stream/pkg/logger"
+	"strings"
+	"testing"
+	"time"
+)
+
+var pngImage = []byte("\x89PNG\r\n\x1a\nfake")
+
+func imageMessage(url string) string {
+	return `{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"` + url + `"}}]}`
+}
+
+func TestValidateParts(t *testing.T) {
+	dataURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngImage)
+	vision := chat.ModelIDLLAMA3211BVision
+
+	tests := []struct {
+		name   string
+		msgs   string
+		model  chat.ModelID
+		fields []string
+	}{
+		{"data url", imageMessage(dataURL), vision, nil},
+		{"remote url", imageMessage("https://example.com/cat.png"), vision, nil},
+		{"text model", imageMessage(dataURL), chat.ModelIDLLAMA38B, []string{"messages[0].content[1]"}},
+		{"bad scheme", imageMessage("ftp://example.com/cat.png"), vision, []string{"messages[0].content[1].image_url.url"}},
+		{"bad type", imageMessage("data:image/tiff;base64,AAAA"), vision, []string{"messages[0].content[1].image_url.url"}},
+		{"bad base64", imageMessage("data:image/png;base64,!!!"), vision, []string{"messages[0].content[1].image_url.url"}},
+		{"unknown part", `{"role":"user","content":[{"type":"audio"}]}`, vision, []string{"messages[0].content[0].type"}},
+		{"assistant image", strings.Replace(imageMessage(dataURL), "user", "assistant", 1), vision, []string{"messages[0].content[1]"}},
+		{"too many images", strings.Repeat(imageMessage(dataURL)+",", 5) + imageMessage(dataURL), vision, []string{"messages"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msgs []ChatMessage
+			if err := json.Unmarshal([]byte("["+tt.msgs+"]"), &msgs); err != nil {
+				t.Fatalf("failed to decode messages: %v", err)
+			}
+
+			verr := &ValidationError{}
+			validateParts(msgs, tt.model, verr)
+
+			var got []string
+			for _, fe := range verr.Fields {
+				got = append(got, fe.Field)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.fields, ",") {
+				t.Fatalf("expected fields %v, got %v", tt.fields, verr.Fields)
+			}
+		})
+	}
+}
+
+func TestSendMessage_ImageStoredByReference(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+
+	var got chat.ChatRequest
+	mockClient := &mockGroqClient{
+		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
+			got = req
+			return replyStream("A cat"), func() {}, nil
+		},
+	}
+
+	db := persistence.NewInMemoryStore()
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     l,
+		db:         db,
+		images:     persistence.NewInMemoryImageStore(0),
+	}
+
+	dataURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngImage)
+	jsonBody := []byte(`{"model":"llama-3.2-11b-vision-preview","messages":[` + imageMessage(dataURL) + `]}`)
+	req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	server.SendMessage(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	if len(got.Messages) != 1 || len(got.Messages[0].Parts) != 2 || got.Messages[0].Parts[1].ImageURL.URL != dataURL {
+		t.Fatalf("expected the image to be forwarded upstream, got %+v", got.Messages)
+	}
+
+	// persistence happens in the background once the stream is done
+	var stored []persistence.Message
+	for i := 0; i < 50 && len(stored) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		stored, _ = db.GetRecentMessages("", "some-id", 20)
+	}
+	if len(stored) != 2 || len(stored[0].Parts) != 2 {
+		t.Fatalf("expected the user message to be stored with its parts, got %+v", stored)
+	}
+
+	part := stored[0].Parts[1]
+	if part.ImageRef == "" || part.ImageURL != "" {
+		t.Fatalf("expected the image to be stored by reference, got %+v", part)
+	}
+
+	imgReq := httptest.NewRequest(http.MethodGet, "/images/"+part.ImageRef, nil)
+	imgReq.SetPathValue("ref", part.ImageRef)
+	imgW := httptest.NewRecorder()
+	server.GetImage(imgW, imgReq)
+
+	body, _ := io.ReadAll(imgW.Result().Body)
+	if imgW.Code != http.StatusOK || imgW.Header().Get("Content-Type") != "image/png" || !bytes.Equal(body, pngImage) {
+		t.Fatalf("unexpected image response: %d %q", imgW.Code, imgW.Header().Get("Content-Type"))
+	}
+}
+
+func TestGetImage_Owner(t *testing.T) {
+	images := persistence.NewInMemoryImageStore(0)
+	ref, _ := images.PutImage("alice", pngImage, "image/png")
+	server := &Handler{logger: logger.NewStdLogger(log.Default()), images: images}
+
+	for user, want := range map[string]int{"alice": http.StatusOK, "bob": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/images/"+ref, nil)
+		req.SetPathValue("ref", ref)
+		w := httptest.NewRecorder()
+		asPrincipal(user, http.HandlerFunc(server.GetImage)).ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("image of alice got %d for %s; want %d", w.Code, user, want)
+		}
+	}
+}
+
+func TestSendMessage_BodyTooLarge(t *testing.T) {
+	server := &Handler{logger: logger.NewStdLogger(log.Default())}
+
+	body := `{"messages":[{"role":"user","content":"` + strings.Repeat("a", maxChatBodySize) + `"}]}`
+	w := httptest.NewRecorder()
+	server.SendMessage(w, httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(body)))
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d; want 413", w.Code)
+	}
+}
+
+func TestGetImage_Headers(t *testing.T) {
+	images := persistence.NewInMemoryImageStore(0)
+	server := &Handler{logger: logger.NewStdLogger(log.Default()), images: images}
+
+	for stored, want := range map[string][2]string{
+		"image/png":     {"image/png", "inline"},
+		"image/svg+xml": {"application/octet-stream", "attachment"},
+		"text/html":     {"application/octet-stream", "attachment"},
+	} {
+		ref, _ := images.PutImage("", []byte(stored), stored)
+		req := httptest.NewRequest(http.MethodGet, "/images/"+ref, nil)
+		req.SetPathValue("ref", ref)
+		w := httptest.NewRecorder()
+		server.GetImage(w, req)
+
+		h := w.Header()
+		if h.Get("Content-Type") != want[0] || h.Get("Content-Disposition") != want[1] || h.Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("image stored as %s got headers %v; want %s, %s and nosniff", stored, h, want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"stream/internal/audit"
+	"stream/internal/chat"
+	"stream/pkg/logger"
+	"strings"
+	"time"
+)
+
+// maxProxyBodySize caps the size of OpenAI-compatible request bodies.
+const maxProxyBodySize = 4 << 20
+
+// openAIRequest is the subset of an OpenAI chat completion request the proxy
+// needs to look at; the body itself is forwarded upstream untouched.
+type openAIRequest struct {
+	Model    chat.ModelID    `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+}
+
+type openAIMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// OpenAIError is the error body returned by OpenAI-compatible endpoints.
+type OpenAIError struct {
+	Error OpenAIErrorDetail `json:"error"`
+}
+
+type OpenAIErrorDetail struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+// ChatCompletions handles the POST /v1/chat/completions endpoint.
+//
+//	@Summary		OpenAI-compatible chat completions.
+//	@Description	Accepts an OpenAI chat completion request and forwards it to the LLM, returning the upstream response unchanged. Streams with `data: [DONE]` when `stream` is true.
+//	@Tags			openai
+//	@Accept			json
+//	@Produce		json,text/event-stream
+//	@Param			body	body		object		true	"OpenAI chat completion request"
+//	@Success		200		{object}	object		"Chat completion or stream of chunks"
+//	@Failure		400		{object}	OpenAIError	"Bad Request"
+//	@Failure		429		{string}	string		"Token quota exceeded"
+//	@Failure		502		{object}	OpenAIError	"Bad Gateway"
+//	@Router			/v1/chat/completions [post]
+func (h *Handler) ChatCompletions(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProxyBodySize))
+	if err != nil {
+		h.log(r.Context()).Printf("failed to read request body: %v", err)
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "could not read request body")
+		return
+	}
+
+	var body openAIRequest
+	if err := json.Unmarshal(raw, &body); err != nil {
+		h.log(r.Context()).Printf("failed to decode request body: %v", err)
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "request body is not valid JSON")
+		return
+	}
+	if body.Model == "" {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "you must provide a model parameter")
+		return
+	}
+	if len(body.Messages) == 0 {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "messages must contain at least one message")
+		return
+	}
+
+	logger.AddFields(r.Context(), "model", body.Model)
+
+	if !h.checkQuota(w, r) {
+		return
+	}
+
+	req := chat.ChatRequest{
+		Model:  body.Model,
+		Stream: body.Stream,
+		Raw:    raw,
+	}
+	userMessages := make([]ChatMessage, 0, len(body.Messages))
+	for _, msg := range body.Messages {
+		// content the proxy can't make sense of (e.g. tool calls) is still
+		// forwarded, it's only left out of the stored conversation and the
+		// audit trail
+		text, parts, _ := chat.UnmarshalContent(msg.Content)
+		userMessages = append(userMessages, ChatMessage{Role: msg.Role, Content: text, Parts: parts})
+		// Raw is sent upstream, the messages are only read by the audit trail
+		req.Messages = append(req.Messages, chat.Message{Role: chat.MessageRole(msg.Role), Content: text, Parts: parts})
+	}
+
+	if !body.Stream {
+		h.completeOpenAI(r.Context(), w, start, req, userMessages)
+		return
+	}
+	h.streamOpenAI(r.Context(), w, start, req, userMessages)
+}
+
+// completeOpenAI forwards a non-streaming request and relays the response body as-is.
+func (h *Handler) completeOpenAI(ctx context.Context, w http.ResponseWriter, start time.Time, req chat.ChatRequest, userMessages []ChatMessage) {
+	upstream, span := h.startUpstream(ctx, "groq.Complete", req)
+	resp, err := h.groqClient.Complete(upstream, req)
+	if err != nil {
+		endUpstream(span, chat.Usage{}, err)
+		h.upstreamError(ctx, err)
+		h.log(ctx).Printf("failed to complete chat: %v", err)
+		writeUpstreamError(w, err)
+		return
+	}
+	endUpstream(span, resp.Usage, nil)
+	h.recordUsage(ctx, req.Model, resp.Usage)
+	logger.AddFields(ctx, "conversation_id", resp.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(resp.Raw); err != nil {
+		h.log(ctx).Printf("failed to write response: %v", err)
+		return
+	}
+
+	completions := make([]audit.Completion, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		completions[i] = audit.Completion{Index: choice.Index, Content: choice.Message.Content, FinishReason: choice.FinishReason}
+	}
+	h.auditExchange(ctx, "/v1/chat/completions", start, req, resp.ID, completions, resp.Usage)
+
+	if len(resp.Choices) > 0 {
+		replies := make([]string, len(resp.Choices))
+		for i, choice := range resp.Choices {
+			replies[i] = choice.Message.Content
+		}
+		h.persist(ctx, resp.ID, userMessages, replies)
+	}
+}
+
+// streamOpenAI forwards a streaming request, writing every upstream chunk back
+// unchanged and terminating the stream with `data: [DONE]`.
+func (h *Handler) streamOpenAI(ctx context.Context, w http.ResponseWriter, start time.Time, req chat.ChatRequest, userMessages []ChatMessage) {
+	upstream, span := h.startUpstream(ctx, "groq.SendMessage", req)
+	upstream, stop := h.untilDrained(upstream)
+	defer stop()
+	stream, cancel, err := h.groqClient.SendMessage(upstream, req)
+	if err != nil {
+		endUpstream(span, chat.Usage{}, err)
+		h.upstreamError(ctx, err)
+		h.log(ctx).Printf("failed to send message: %v", err)
+		writeUpstreamError(w, err)
+		return
+	}
+	defer cancel()
+	h.metrics.StreamStarted()
+	defer h.metrics.StreamEnded()
+
+	var (
+		started        bool
+		firstToken     bool
+		conversationID string
+		replies        []strings.Builder
+		finishReasons  []string
+		usage          *chat.Usage
+		streamErr      error
+	)
+	chunks := chunkSpans{tracer: h.tracer, ctx: upstream}
+	defer func() {
+		chunks.end()
+		if usage != nil {
+			endUpstream(span, *usage, streamErr)
+			h.recordUsage(ctx, req.Model, *usage)
+		} else {
+			endUpstream(span, chat.Usage{}, streamErr)
+		}
+	}()
+
+	for response := range stream {
+		if response.Error != nil {
+			streamErr = response.Error
+			h.upstreamError(ctx, response.Error)
+			h.log(ctx).Printf("error in SSE stream: %v", response.Error)
+			if !started {
+				writeUpstreamError(w, response.Error)
+				return
+			}
+			// Headers are already out, report the failure as a final chunk.
+			writeSSEData(w, openAIErrorBody("api_error", response.Error.Error()))
+			return
+		}
+
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+
+		if response.Response.ID != "" && conversationID == "" {
+			logger.AddFields(ctx, "conversation_id", response.Response.ID)
+		}
+		if response.Response.ID != "" {
+			conversationID = response.Response.ID
+		}
+		if u, ok := response.Response.StreamUsage(); ok {
+			usage = &u
+		}
+		for _, choice := range response.Response.Choices {
+			if choice.Index < 0 || choice.Index >= maxChoices {
+				continue
+			}
+			if choice.Index >= len(replies) {
+				replies = append(replies, make([]strings.Builder, choice.Index+1-len(replies))...)
+				finishReasons = append(finishReasons, make([]string, choice.Index+1-len(finishReasons))...)
+			}
+			replies[choice.Index].WriteString(choice.Delta.Content)
+			if choice.FinishReason != "" {
+				finishReasons[choice.Index] = choice.FinishReason
+			}
+			if !firstToken && choice.Delta.Content != "" {
+				firstToken = true
+				h.firstToken(span, req.Model, time.Since(start))
+			}
+		}
+
+		if err := writeSSEData(w, response.Response.Raw); err != nil {
+			h.log(ctx).Printf("failed to write response: %v", err)
+			return
+		}
+		chunks.written()
+		h.debug(ctx, "chunk sent", "chunk", string(response.Response.Raw))
+	}
+
+	if shutDown(upstream) {
+		h.log(ctx).Printf("ending stream of %s: %v", conversationID, errShutdown)
+		if !started {
+			writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", errShutdown.Error())
+			return
+		}
+		// like an upstream failure, reported as a final chunk; what was
+		// generated until then is still saved
+		writeSSEData(w, openAIErrorBody("server_error", errShutdown.Error()))
+	} else {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+		}
+		if err := writeSSEData(w, []byte("[DONE]")); err != nil {
+			h.log(ctx).Printf("failed to write response: %v", err)
+			return
+		}
+	}
+
+	if conversationID != "" {
+		contents := make([]string, len(replies))
+		completions := make([]audit.Completion, len(replies))
+		for i := range replies {
+			contents[i] = replies[i].String()
+			completions[i] = audit.Completion{Index: i, Content: contents[i], FinishReason: finishReasons[i]}
+		}
+		var reported chat.Usage
+		if usage != nil {
+			reported = *usage
+		}
+		h.auditExchange(ctx, "/v1/chat/completions", start, req, conversationID, completions, reported)
+		h.persist(ctx, conversationID, userMessages, contents)
+	}
+}
+
+// writeUpstreamError relays an upstream API error verbatim, or reports a 502
+// when the upstream could not be reached at all.
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	var apiErr *chat.APIError
+	if errors.As(err, &apiErr) && len(apiErr.Body) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(apiErr.StatusCode)
+		w.Write(apiErr.Body)
+		return
+	}
+	writeOpenAIError(w, http.StatusBadGateway, "api_error", "upstream provider request failed")
+}
+
+func writeOpenAIError(w http.ResponseWriter, status int, errType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(openAIErrorBody(errType, message))
+}
+
+func openAIErrorBody(errType, message string) []byte {
+	b, _ := json.Marshal(OpenAIError{
+		Error: OpenAIErrorDetail{Message: message, Type: errType},
+	})
+	return b
+}
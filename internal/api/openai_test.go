@@ -0,0 +1,170 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/chat"
+	"stream/internal/persistence"
+	"stream/pkg/logger"
+	"strings"
+	"testing"
+)
+
+func TestChatCompletions_StreamPassthrough(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+
+	chunk := `{"id":"chatcmpl-1","object":"chat.completion.chunk","x_groq":{"id":"req_1"},"choices":[{"index":0,"delta":{"content":"Hi"}}]}`
+	var got chat.ChatRequest
+	mockClient := &mockGroqClient{
+		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
+			got = req
+			stream := make(chan *chat.ChatStreamResponse)
+			go func() {
+				defer close(stream)
+				var resp chat.ChatResponse
+				_ = json.Unmarshal([]byte(chunk), &resp)
+				resp.Raw = json.RawMessage(chunk)
+				stream <- &chat.ChatStreamResponse{Response: resp}
+			}()
+			return stream, func() {}, nil
+		},
+	}
+
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     l,
+		db:         persistence.NewInMemoryStore(),
+	}
+
+	reqBody := `{"model":"llama3-8b-8192","stream":true,"tools":[],"messages":[{"role":"user","content":"Hello"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(reqBody))
+	w := httptest.NewRecorder()
+
+	server.ChatCompletions(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", res.StatusCode)
+	}
+	if string(got.Raw) != reqBody {
+		t.Errorf("expected request to be forwarded untouched, got %s", got.Raw)
+	}
+
+	responseBody, _ := io.ReadAll(res.Body)
+	want := "data: " + chunk + "\n\ndata: [DONE]\n\n"
+	if string(responseBody) != want {
+		t.Fatalf("unexpected stream body:\n got: %q\nwant: %q", responseBody, want)
+	}
+}
+
+func TestChatCompletions_NonStream(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+
+	raw := `{"id":"chatcmpl-2","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}]}`
+	mockClient := &mockGroqClient{
+		CompleteFn: func(ctx context.Context, req chat.ChatRequest) (*chat.ChatResponse, error) {
+			var resp chat.ChatResponse
+			_ = json.Unmarshal([]byte(raw), &resp)
+			resp.Raw = json.RawMessage(raw)
+			return &resp, nil
+		},
+	}
+
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     l,
+		db:         persistence.NewInMemoryStore(),
+	}
+
+	reqBody := `{"model":"llama3-8b-8192","messages":[{"role":"user","content":[{"type":"text","text":"Hello"}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(reqBody))
+	w := httptest.NewRecorder()
+
+	server.ChatCompletions(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", res.StatusCode)
+	}
+	responseBody, _ := io.ReadAll(res.Body)
+	if string(responseBody) != raw {
+		t.Fatalf("expected body %s, got %s", raw, responseBody)
+	}
+}
+
+func TestChatCompletions_UpstreamError(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+
+	upstream := `{"error":{"message":"model not found","type":"invalid_request_error"}}`
+	mockClient := &mockGroqClient{
+		CompleteFn: func(ctx context.Context, req chat.ChatRequest) (*chat.ChatResponse, error) {
+			return nil, &chat.APIError{StatusCode: http.StatusNotFound, Body: []byte(upstream)}
+		},
+		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
+			stream := make(chan *chat.ChatStreamResponse, 1)
+			stream <- &chat.ChatStreamResponse{Error: errors.New("connection refused")}
+			close(stream)
+			return stream, func() {}, nil
+		},
+	}
+
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     l,
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"non-stream", `{"model":"nope","messages":[{"role":"user","content":"Hi"}]}`, http.StatusNotFound},
+		{"stream", `{"model":"nope","stream":true,"messages":[{"role":"user","content":"Hi"}]}`, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			server.ChatCompletions(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, res.StatusCode)
+			}
+			var body OpenAIError
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil || body.Error.Message == "" {
+				t.Fatalf("expected OpenAI error body, got err=%v body=%+v", err, body)
+			}
+		})
+	}
+}
+
+func TestChatCompletions_InvalidRequest(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+	server := &Handler{
+		logger: l,
+	}
+
+	for _, body := range []string{`{invalid`, `{"messages":[{"role":"user","content":"Hi"}]}`, `{"model":"llama3-8b-8192"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+
+		server.ChatCompletions(w, req)
+		res := w.Result()
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("body %s: expected status 400, got %d", body, res.StatusCode)
+		}
+	}
+}
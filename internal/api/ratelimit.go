@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"stream/internal/ratelimit"
+	"stream/pkg/logger"
+	"time"
+)
+
+// RateLimit returns a middleware that allows each client the requests of the
+// limit returned by limit, called on every request so it can change at run
+// time, and answers the rest with 429 Too Many Requests. A limit with a zero
+// rate turns rate limiting off. Clients are told apart by their principal when
+// the request is authenticated, by IP address otherwise.
+func RateLimit(l logger.Logger, store ratelimit.Store, limit func() ratelimit.Limit) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lim := limit()
+			if lim.Rate <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := store.Take(r.Context(), rateLimitKey(r), lim, time.Now())
+			if err != nil {
+				// don't turn an unavailable store into an outage
+				requestLogger(r.Context(), l).Printf("failed to check rate limit: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies the client a request counts against.
+func rateLimitKey(r *http.Request) string {
+	if p, ok := PrincipalFromContext(r.Context()); ok {
+		return p.Method + ":" + p.ID
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
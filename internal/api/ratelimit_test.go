@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/ratelimit"
+	"stream/pkg/logger"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	limit := ratelimit.PerMinute(1, 2)
+	handler := RateLimit(logger.Info, ratelimit.NewMemoryStore(), func() ratelimit.Limit { return limit })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(remoteAddr string, p *Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/chat", nil)
+		req.RemoteAddr = remoteAddr
+		if p != nil {
+			req = req.WithContext(WithPrincipal(req.Context(), *p))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	alice := &Principal{ID: "alice", Method: "api_key"}
+	for i := 0; i < 2; i++ {
+		if w := request("10.0.0.1:1234", alice); w.Code != http.StatusOK {
+			t.Fatalf("expected request %d to be allowed, got %d", i, w.Code)
+		}
+	}
+
+	w := request("10.0.0.2:1234", alice)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for a principal over its limit on another address, got %d", w.Code)
+	}
+	for header, want := range map[string]string{
+		"Retry-After":           "60",
+		"X-RateLimit-Limit":     "2",
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     "120",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Fatalf("expected %s %q, got %q", header, want, got)
+		}
+	}
+
+	// others have their own buckets
+	if w := request("10.0.0.1:1234", &Principal{ID: "bob", Method: "jwt"}); w.Code != http.StatusOK {
+		t.Fatalf("expected another principal to be allowed, got %d", w.Code)
+	}
+	if w := request("10.0.0.1:1234", nil); w.Code != http.StatusOK {
+		t.Fatalf("expected an anonymous client to be limited by address, got %d", w.Code)
+	}
+
+	// the limit is read on every request, a zero rate turns limiting off
+	limit = ratelimit.PerMinute(0, 2)
+	w = request("10.0.0.2:1234", alice)
+	if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+		t.Fatalf("expected rate limiting to be turned off, got %d with limit %q", w.Code, w.Header().Get("X-RateLimit-Limit"))
+	}
+}
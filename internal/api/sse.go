@@ -0,0 +1,52 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// writeEvent writes a server-sent event and flushes it to the client. Every
+// line of data gets its own `data:` field so clients reassemble newlines as
+// they were sent. An empty event name sends a default "message" event.
+func writeEvent(w http.ResponseWriter, event, data string) error {
+	var b bytes.Buffer
+	if event != "" {
+		b.WriteString("event: ")
+		b.WriteString(event)
+		b.WriteByte('\n')
+	}
+
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// writeJSONEvent writes a server-sent event whose data is v encoded as JSON.
+func writeJSONEvent(w http.ResponseWriter, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeEvent(w, event, string(data))
+}
+
+// writeSSEData writes a single unnamed `data:` event, as used by the OpenAI
+// streaming format.
+func writeSSEData(w http.ResponseWriter, data []byte) error {
+	return writeEvent(w, "", string(data))
+}
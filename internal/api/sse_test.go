@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event string
+		data  string
+		want  string
+	}{
+		{"plain", "", "Hello", "data: Hello\n\n"},
+		{"named", "validation", `{"valid":true}`, "event: validation\ndata: {\"valid\":true}\n\n"},
+		{"trailing newline", "", "Hello\n", "data: Hello\ndata: \n\n"},
+		{"blank lines", "", "\n\n", "data: \ndata: \ndata: \n\n"},
+		{"crlf", "", "a\r\nb", "data: a\ndata: b\n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := writeEvent(w, tt.event, tt.data); err != nil {
+				t.Fatalf("writeEvent returned error: %v", err)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
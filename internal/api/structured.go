@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"stream/internal/chat"
+	"stream/internal/schema"
+	"strings"
+)
+
+// ValidationResult reports whether the assistant output matched the requested
+// response format. It is sent as the `validation` event at the end of a stream.
+type ValidationResult struct {
+	Index    int      `json:"index"` // Index of the validated choice
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors,omitempty"`
+	Attempt  int      `json:"attempt"`  // 1 for the first generation, 2 for the retry
+	Retrying bool     `json:"retrying"` // Whether a new generation follows this event
+}
+
+// outputValidator checks the accumulated assistant output against the response
+// format requested by the client.
+type outputValidator struct {
+	format *chat.ResponseFormat
+	schema *schema.Schema // nil for plain JSON mode
+}
+
+// newOutputValidator returns nil when the format doesn't ask for JSON output.
+func newOutputValidator(format *chat.ResponseFormat) (*outputValidator, error) {
+	if format == nil {
+		return nil, nil
+	}
+
+	switch format.Type {
+	case chat.ResponseFormatText:
+		return nil, nil
+	case chat.ResponseFormatJSONObject:
+		return &outputValidator{format: format}, nil
+	case chat.ResponseFormatJSONSchema:
+		if format.JSONSchema == nil || len(format.JSONSchema.Schema) == 0 {
+			return nil, fmt.Errorf("json_schema.schema is required")
+		}
+		s, err := schema.Parse(format.JSONSchema.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json_schema.schema: %v", err)
+		}
+		return &outputValidator{format: format, schema: s}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %q", format.Type)
+	}
+}
+
+// check validates the assistant output.
+func (v *outputValidator) check(output string, attempt int) ValidationResult {
+	result := ValidationResult{Attempt: attempt}
+
+	if v.schema == nil {
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(output), &obj); err != nil {
+			result.Errors = []string{fmt.Sprintf("output is not a JSON object: %v", err)}
+			return result
+		}
+		result.Valid = true
+		return result
+	}
+
+	for _, e := range v.schema.Validate([]byte(output)) {
+		result.Errors = append(result.Errors, e.String())
+	}
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+// apply sets up req for JSON output. The upstream request always uses JSON
+// mode, which every model supports; when a schema is given it is passed to the
+// model as a system instruction and enforced here once the output is complete.
+func (v *outputValidator) apply(req *chat.ChatRequest) {
+	req.ResponseFormat = &chat.ResponseFormat{Type: chat.ResponseFormatJSONObject}
+
+	var b strings.Builder
+	b.WriteString("Respond only with a JSON object.")
+	if v.schema != nil {
+		js := v.format.JSONSchema
+		fmt.Fprintf(&b, " The object must be valid against the JSON Schema named %q", js.Name)
+		if js.Description != "" {
+			fmt.Fprintf(&b, " (%s)", js.Description)
+		}
+		fmt.Fprintf(&b, ":\n%s", js.Schema)
+	}
+
+	req.Messages = append([]chat.Message{{
+		Role:    chat.MessageRoleSystem,
+		Content: b.String(),
+	}}, req.Messages...)
+}
+
+// retryMessages returns the messages appended to the conversation when the
+// output failed validation and the generation is attempted again.
+func retryMessages(output string, result ValidationResult) []chat.Message {
+	return []chat.Message{
+		{Role: chat.MessageRoleAssistant, Content: output},
+		{
+			Role: chat.MessageRoleUser,
+			Content: "Your previous reply did not match the required format:\n- " +
+				strings.Join(result.Errors, "\n- ") +
+				"\nReply again with only the corrected JSON.",
+		},
+	}
+}
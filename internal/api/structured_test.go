@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/chat"
+	"stream/internal/persistence"
+	"stream/pkg/logger"
+	"strings"
+	"testing"
+)
+
+// replyStream returns a stream that sends content as a single delta.
+func replyStream(content string) <-chan *chat.ChatStreamResponse {
+	stream := make(chan *chat.ChatStreamResponse)
+	go func() {
+		defer close(stream)
+		stream <- &chat.ChatStreamResponse{
+			Response: chat.ChatResponse{
+				ID:      "some-id",
+				Choices: []chat.Choice{{Delta: chat.Message{Role: "assistant", Content: content}}},
+			},
+		}
+	}()
+	return stream
+}
+
+func TestSendMessage_JSONSchemaRetry(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+
+	var requests []chat.ChatRequest
+	replies := []string{`{"name":42}`, `{"name":"Ada"}`}
+	mockClient := &mockGroqClient{
+		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
+			requests = append(requests, req)
+			return replyStream(replies[len(requests)-1]), func() {}, nil
+		},
+	}
+
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     l,
+		db:         persistence.NewInMemoryStore(),
+	}
+
+	jsonBody := []byte(`{
+		"messages": [{"role":"user","content":"Who wrote the first program?"}],
+		"response_format": {"type":"json_schema","json_schema":{"name":"person","schema":{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]}}},
+		"retry_on_invalid": true
+	}`)
+	req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	server.SendMessage(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", res.StatusCode)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 generations, got %d", len(requests))
+	}
+	if rf := requests[0].ResponseFormat; rf == nil || rf.Type != chat.ResponseFormatJSONObject {
+		t.Errorf("expected upstream JSON mode, got %+v", rf)
+	}
+	if requests[0].Messages[0].Role != chat.MessageRoleSystem {
+		t.Errorf("expected the schema to be sent as a system message")
+	}
+	if n := len(requests[1].Messages); n != len(requests[0].Messages)+2 {
+		t.Errorf("expected the retry to include the failed reply and feedback, got %d messages", n)
+	}
+
+	responseBody, _ := io.ReadAll(res.Body)
+	events := strings.Split(strings.TrimSpace(string(responseBody)), "\n\n")
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %d: %q", len(events), responseBody)
+	}
+
+	var first, second ValidationResult
+	decodeValidationEvent(t, events[1], &first)
+	decodeValidationEvent(t, events[3], &second)
+	if first.Valid || !first.Retrying || first.Attempt != 1 || len(first.Errors) == 0 {
+		t.Errorf("unexpected first validation: %+v", first)
+	}
+	if !second.Valid || second.Retrying || second.Attempt != 2 {
+		t.Errorf("unexpected second validation: %+v", second)
+	}
+}
+
+func TestSendMessage_JSONObjectNonStreaming(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+
+	mockClient := &mockGroqClient{
+		CompleteFn: func(ctx context.Context, req chat.ChatRequest) (*chat.ChatResponse, error) {
+			return &chat.ChatResponse{
+				ID:      "some-id",
+				Choices: []chat.Choice{{Message: chat.Message{Role: "assistant", Content: "not json"}}},
+			}, nil
+		},
+	}
+
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     l,
+		db:         persistence.NewInMemoryStore(),
+	}
+
+	jsonBody := []byte(`{"messages":[{"role":"user","content":"Hi"}],"stream":false,"response_format":{"type":"json_object"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	server.SendMessage(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+
+	var got ChatResponseBody
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if got.Validation == nil || got.Validation.Valid {
+		t.Fatalf("expected a failed validation, got %+v", got.Validation)
+	}
+}
+
+func TestSendMessage_InvalidResponseFormat(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+	server := &Handler{
+		logger: l,
+	}
+
+	for _, schema := range []string{`{"type":"float"}`, `{"type":"object","properties":{"a":{"$ref":"#/$defs/a"}},"$defs":{"a":{"type":"string"}}}`} {
+		jsonBody := []byte(`{"messages":[{"role":"user","content":"Hi"}],"response_format":{"type":"json_schema","json_schema":{"name":"x","schema":` + schema + `}}}`)
+		req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBuffer(jsonBody))
+		w := httptest.NewRecorder()
+
+		server.SendMessage(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: expected status 400, got %d", schema, res.StatusCode)
+		}
+		var body ValidationErrorBody
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil || len(body.Fields) != 1 || body.Fields[0].Field != "response_format" {
+			t.Errorf("%s: expected a response_format field error, got %+v (%v)", schema, body, err)
+		}
+	}
+}
+
+func decodeValidationEvent(t *testing.T, event string, v *ValidationResult) {
+	t.Helper()
+
+	data, ok := strings.CutPrefix(event, "event: validation\ndata: ")
+	if !ok {
+		t.Fatalf("expected a validation event, got %q", event)
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		t.Fatalf("failed to decode validation event: %v", err)
+	}
+}
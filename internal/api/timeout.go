@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// WriteTimeout returns a middleware that gives handlers timeout() from the
+// start of the request to write their whole response; the connection is
+// closed by a write past it. Zero is no limit.
+func WriteTimeout(timeout func() time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d := timeout(); d > 0 {
+				// not every writer supports deadlines, such as test recorders
+				http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// StreamWriteTimeout returns a middleware for handlers that stream their
+// response. Instead of the whole response, each write gets timeout(), so
+// streams may last as long as the client keeps reading them. Zero is no limit.
+func StreamWriteTimeout(timeout func() time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d := timeout(); d > 0 {
+				w = &deadlineWriter{ResponseWriter: w, rc: http.NewResponseController(w), timeout: d}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// deadlineWriter moves the write deadline of the connection before every
+// write and flush.
+type deadlineWriter struct {
+	http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (w *deadlineWriter) Write(b []byte) (int, error) {
+	w.rc.SetWriteDeadline(time.Now().Add(w.timeout))
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *deadlineWriter) Flush() {
+	w.rc.SetWriteDeadline(time.Now().Add(w.timeout))
+	w.rc.Flush()
+}
+
+func (w *deadlineWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stream/pkg/logger"
+	"testing"
+	"time"
+)
+
+func TestWriteTimeout(t *testing.T) {
+	timeout := func() time.Duration { return 50 * time.Millisecond }
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for range 3 {
+			time.Sleep(40 * time.Millisecond)
+			writeEvent(w, "", "tick")
+		}
+	})
+
+	tests := []struct {
+		name       string
+		middleware Middleware
+		complete   bool
+	}{
+		{"whole response", WriteTimeout(timeout), false},
+		{"each write", StreamWriteTimeout(timeout), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(Logging(logger.NewText(io.Discard), tt.middleware(slow)))
+			defer server.Close()
+
+			res, err := http.Get(server.URL)
+			if err != nil {
+				if tt.complete {
+					t.Fatal(err)
+				}
+				return
+			}
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			complete := err == nil && string(body) == "data: tick\n\ndata: tick\n\ndata: tick\n\n"
+			if complete != tt.complete {
+				t.Errorf("got complete response %v (%q, %v); want %v", complete, body, err, tt.complete)
+			}
+		})
+	}
+}
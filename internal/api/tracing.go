@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"stream/internal/chat"
+	"stream/internal/tracing"
+	"stream/pkg/logger"
+	"time"
+)
+
+// Tracing returns a middleware that traces every request in a server span,
+// continuing the trace of an incoming W3C traceparent header. Like
+// Instrument, it names spans after the route pattern, so only Instrument may
+// sit between it and the *http.ServeMux.
+func Tracing(t *tracing.Tracer) Middleware {
+	return func(next http.Handler) http.Handler {
+		if t == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := tracing.Extract(r.Context(), r.Header)
+			ctx, span := t.StartKind(ctx, r.Method+" "+r.URL.Path, tracing.KindServer,
+				tracing.String("http.request.method", r.Method),
+				tracing.String("url.path", r.URL.Path),
+			)
+			defer span.End()
+			if _, ok := tracing.ParseTraceparent(r.Header.Get("traceparent")); !ok {
+				// Logging only knows the trace IDs of incoming headers
+				logger.AddFields(ctx, "trace_id", span.SpanContext().TraceID.String())
+			}
+
+			wrapped := &wrappedWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+			r = r.WithContext(ctx)
+			next.ServeHTTP(wrapped, r)
+
+			if r.Pattern != "" {
+				span.SetName(r.Pattern)
+				span.SetAttributes(tracing.String("http.route", r.Pattern))
+			}
+			span.SetAttributes(tracing.Int("http.response.status_code", wrapped.statusCode))
+			if wrapped.statusCode >= 500 {
+				span.SetStatus(tracing.StatusError, http.StatusText(wrapped.statusCode))
+			}
+		})
+	}
+}
+
+// startUpstream starts a client span for a request to the model provider.
+// The returned context carries the span, so the chat client propagates it.
+func (h *Handler) startUpstream(ctx context.Context, name string, req chat.ChatRequest) (context.Context, *tracing.Span) {
+	return h.tracer.StartKind(ctx, name, tracing.KindClient,
+		tracing.String("gen_ai.system", "groq"),
+		tracing.String("gen_ai.request.model", string(req.Model)),
+		tracing.Int("gen_ai.request.max_tokens", req.MaxTokens),
+		tracing.Int("gen_ai.request.choice.count", max(req.N, 1)),
+		tracing.Bool("stream", req.Stream),
+	)
+}
+
+// endUpstream records the outcome of a request to the model provider and
+// ends its span.
+func endUpstream(span *tracing.Span, usage chat.Usage, err error) {
+	if usage.TotalTokens > 0 {
+		span.SetAttributes(
+			tracing.Int("gen_ai.usage.input_tokens", usage.PromptTokens),
+			tracing.Int("gen_ai.usage.output_tokens", usage.CompletionTokens),
+		)
+	}
+	span.RecordError(err)
+	span.End()
+}
+
+// firstToken records the time a streamed completion took to start.
+func (h *Handler) firstToken(span *tracing.Span, model chat.ModelID, d time.Duration) {
+	h.metrics.ObserveFirstToken(string(model), d)
+	span.SetAttributes(tracing.Float("gen_ai.response.time_to_first_token", d.Seconds()))
+}
+
+// chunksPerSpan is the number of SSE chunks traced by each "sse.chunks" span.
+const chunksPerSpan = 32
+
+// chunkSpans traces the chunks of a stream written to the client in batches,
+// rather than one span per token.
+type chunkSpans struct {
+	tracer *tracing.Tracer
+	ctx    context.Context
+	span   *tracing.Span
+	chunks int
+}
+
+// written counts a chunk written to the client.
+func (c *chunkSpans) written() {
+	if c.span == nil {
+		_, c.span = c.tracer.Start(c.ctx, "sse.chunks")
+		c.chunks = 0
+	}
+	c.chunks++
+	if c.chunks == chunksPerSpan {
+		c.end()
+	}
+}
+
+// end ends the current batch.
+func (c *chunkSpans) end() {
+	if c.span != nil {
+		c.span.SetAttributes(tracing.Int("chunks", c.chunks))
+		c.span.End()
+		c.span = nil
+	}
+}
+
+// storeOp traces the ConversationStore operation op done by fn.
+func (h *Handler) storeOp(ctx context.Context, op, conversationID string, fn func() error) error {
+	_, span := h.tracer.Start(ctx, "conversations."+op,
+		tracing.String("db.operation.name", op),
+		tracing.String("conversation.id", conversationID),
+	)
+	err := fn()
+	span.RecordError(err)
+	span.End()
+	return err
+}
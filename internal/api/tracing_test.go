@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/chat"
+	"stream/internal/persistence"
+	"stream/internal/tracing"
+	"stream/pkg/logger"
+	"testing"
+	"time"
+)
+
+func TestSendMessage_Tracing(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	tracer := tracing.NewTracer(exporter)
+
+	var outbound string
+	mockClient := &mockGroqClient{
+		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
+			h := http.Header{}
+			tracing.Inject(ctx, h)
+			outbound = h.Get("traceparent")
+
+			stream := make(chan *chat.ChatStreamResponse, 41)
+			for range 40 {
+				stream <- &chat.ChatStreamResponse{Response: chat.ChatResponse{ID: "some-id", Choices: []chat.Choice{{Delta: chat.Message{Content: "a"}}}}}
+			}
+			stream <- &chat.ChatStreamResponse{Response: chat.ChatResponse{ID: "some-id", XGroq: &chat.XGroq{Usage: &chat.Usage{PromptTokens: 3, CompletionTokens: 40, TotalTokens: 43}}}}
+			close(stream)
+			return stream, func() {}, nil
+		},
+	}
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     logger.NewStdLogger(log.Default()),
+		db:         persistence.NewInMemoryStore(),
+		tracer:     tracer,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat", server.SendMessage)
+
+	req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBufferString(`{"messages":[{"role":"user","content":"Hello"}]}`))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	Tracing(tracer)(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+	// the exchange is saved in the background
+	var spans map[string][]tracing.SpanData
+	for deadline := time.Now().Add(time.Second); ; {
+		spans = make(map[string][]tracing.SpanData)
+		for _, s := range exporter.Spans() {
+			spans[s.Name] = append(spans[s.Name], s)
+		}
+		if len(spans["conversations.GetRecentMessages"]) == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	serverSpan, upstream := spans["POST /chat"], spans["groq.SendMessage"]
+	if len(serverSpan) != 1 || len(upstream) != 1 {
+		t.Fatalf("spans = %v; want one server and one upstream span", spans)
+	}
+	if got := serverSpan[0].SpanContext.TraceID.String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s; want the incoming one", got)
+	}
+	if upstream[0].Parent != serverSpan[0].SpanContext.SpanID || upstream[0].Kind != tracing.KindClient {
+		t.Errorf("upstream span = %+v; want a client span under the server span", upstream[0])
+	}
+	if want := upstream[0].SpanContext.Traceparent(); outbound != want {
+		t.Errorf("outbound traceparent = %q; want %q", outbound, want)
+	}
+
+	attrs := make(map[string]any)
+	for _, a := range upstream[0].Attributes {
+		attrs[a.Key] = a.Value
+	}
+	if attrs["gen_ai.request.model"] != string(chat.ModelIDLLAMA38B) || attrs["gen_ai.usage.input_tokens"] != int64(3) || attrs["gen_ai.usage.output_tokens"] != int64(40) {
+		t.Errorf("upstream attributes = %v", attrs)
+	}
+	if _, ok := attrs["gen_ai.response.time_to_first_token"]; !ok {
+		t.Errorf("upstream attributes = %v; want the time to first token", attrs)
+	}
+
+	if chunks := spans["sse.chunks"]; len(chunks) != 2 || chunks[0].Parent != upstream[0].SpanContext.SpanID {
+		t.Errorf("chunk spans = %+v; want 2 batches under the upstream span", chunks)
+	}
+	if n := len(spans["conversations.AppendMessage"]); n != 2 {
+		t.Errorf("AppendMessage spans = %d; want 2", n)
+	}
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"stream/internal/chat"
+	"stream/internal/config"
+	"stream/internal/persistence"
+	"time"
+)
+
+// maxUsageDays caps the range of days GET /usage reports on.
+const maxUsageDays = 366
+
+// UsageTotals sums the usage of several days and models.
+type UsageTotals struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (t *UsageTotals) add(u persistence.Usage) {
+	t.Requests += u.Requests
+	t.PromptTokens += u.PromptTokens
+	t.CompletionTokens += u.CompletionTokens
+	t.TotalTokens += u.PromptTokens + u.CompletionTokens
+}
+
+// QuotaStatus reports the quota of the caller and how much of it is used.
+type QuotaStatus struct {
+	config.Quota
+	UsedToday     int `json:"used_today"`
+	UsedThisMonth int `json:"used_this_month"`
+}
+
+// UsageBody is returned by GET /usage.
+type UsageBody struct {
+	From  string              `json:"from"`
+	To    string              `json:"to"`
+	Usage []persistence.Usage `json:"usage"` // Per day and model
+	Total UsageTotals         `json:"total"`
+	Quota QuotaStatus         `json:"quota"`
+}
+
+// quotaStatus returns the tokens used by owner today and this month.
+func (h *Handler) quotaStatus(owner string, quota config.Quota, now time.Time) (QuotaStatus, error) {
+	status := QuotaStatus{Quota: quota}
+
+	now = now.UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	usage, err := h.usage.GetUsage(owner, monthStart, now)
+	if err != nil {
+		return status, err
+	}
+
+	today := now.Format(persistence.DayLayout)
+	for _, u := range usage {
+		tokens := u.PromptTokens + u.CompletionTokens
+		status.UsedThisMonth += tokens
+		if u.Day == today {
+			status.UsedToday += tokens
+		}
+	}
+	return status, nil
+}
+
+// checkQuota answers with 429 Too Many Requests and returns false when the
+// caller has used up its token quota. Usage that can't be read doesn't block
+// requests.
+func (h *Handler) checkQuota(w http.ResponseWriter, r *http.Request) bool {
+	quota := h.settings().Quota
+	if h.usage == nil || (quota.Daily == 0 && quota.Monthly == 0) {
+		return true
+	}
+
+	now := time.Now().UTC()
+	status, err := h.quotaStatus(ownerOf(r.Context()), quota, now)
+	if err != nil {
+		h.log(r.Context()).Printf("failed to check quota: %v", err)
+		return true
+	}
+
+	var reset time.Time
+	switch {
+	case quota.Monthly > 0 && status.UsedThisMonth >= quota.Monthly:
+		reset = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	case quota.Daily > 0 && status.UsedToday >= quota.Daily:
+		reset = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	default:
+		return true
+	}
+
+	h.log(r.Context()).Printf("rejecting request: token quota of %q exceeded", ownerOf(r.Context()))
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(reset.Sub(now))))
+	http.Error(w, "Token quota exceeded", http.StatusTooManyRequests)
+	return false
+}
+
+// recordUsage counts the tokens and cost of a completion towards the caller's
+// usage and the generation speed metric, and raises a budget alert when the
+// caller's budget is crossed.
+func (h *Handler) recordUsage(ctx context.Context, model chat.ModelID, usage chat.Usage) {
+	h.metrics.ObserveTokenRate(string(model), usage.CompletionTokens, time.Duration(usage.CompletionTime*float64(time.Second)))
+	if h.usage == nil {
+		return
+	}
+
+	now := time.Now()
+	cost, _ := h.pricing.Cost(model, usage)
+	err := h.usage.AddUsage(now, persistence.Usage{
+		Owner:            ownerOf(ctx),
+		Key:              credentialOf(ctx),
+		Model:            string(model),
+		Requests:         1,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Cost:             cost,
+	})
+	if err != nil {
+		h.log(ctx).Printf("failed to record usage: %v", err)
+		return
+	}
+
+	if cost > 0 {
+		h.checkBudget(ctx, now)
+	}
+}
+
+// GetUsage handles the GET /usage endpoint.
+//
+//	@Summary		Token usage of the caller.
+//	@Description	Returns the tokens used per day and model between `from` and `to` (YYYY-MM-DD, inclusive, UTC), by default the current month, along with the caller's quota.
+//	@Tags			usage
+//	@Produce		json
+//	@Param			from	query		string		false	"First day, YYYY-MM-DD"
+//	@Param			to		query		string		false	"Last day, YYYY-MM-DD"
+//	@Success		200		{object}	UsageBody	"Usage of the caller"
+//	@Failure		400		{string}	string		"Bad Request"
+//	@Failure		500		{string}	string		"Internal Server Error"
+//	@Router			/usage [get]
+func (h *Handler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	from, to, err := usageRange(r, now)
+	if err != nil {
+		h.log(r.Context()).Printf("rejecting request: %v", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	body := UsageBody{
+		From:  from.Format(persistence.DayLayout),
+		To:    to.Format(persistence.DayLayout),
+		Usage: []persistence.Usage{},
+	}
+	if h.usage != nil {
+		owner := ownerOf(r.Context())
+		usage, err := h.usage.GetUsage(owner, from, to)
+		if err == nil {
+			body.Quota, err = h.quotaStatus(owner, h.settings().Quota, now)
+		}
+		if err != nil {
+			h.log(r.Context()).Printf("failed to get usage: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		for _, u := range usage {
+			body.Total.add(u)
+		}
+		if usage != nil {
+			body.Usage = usage
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.log(r.Context()).Printf("failed to write response: %v", err)
+	}
+}
+
+// usageRange parses the from and to query parameters of GET /usage.
+func usageRange(r *http.Request, now time.Time) (time.Time, time.Time, error) {
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(persistence.DayLayout, v)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from %q: want YYYY-MM-DD", v)
+		}
+		from = t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(persistence.DayLayout, v)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to %q: want YYYY-MM-DD", v)
+		}
+		to = t
+	}
+
+	if to.Before(from) {
+		return from, to, fmt.Errorf("to %s is before from %s", to.Format(persistence.DayLayout), from.Format(persistence.DayLayout))
+	}
+	if to.Sub(from) > maxUsageDays*24*time.Hour {
+		return from, to, fmt.Errorf("range exceeds %d days", maxUsageDays)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/chat"
+	"stream/internal/config"
+	"stream/internal/persistence"
+	"stream/pkg/logger"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendMessage_RecordsUsage(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+
+	var sent chat.ChatRequest
+	mockClient := &mockGroqClient{
+		SendMessageFn: func(ctx context.Context, req chat.ChatRequest) (<-chan *chat.ChatStreamResponse, func(), error) {
+			sent = req
+			stream := make(chan *chat.ChatStreamResponse)
+			go func() {
+				defer close(stream)
+				stream <- &chat.ChatStreamResponse{Response: chat.ChatResponse{
+					ID:      "some-id",
+					Choices: []chat.Choice{{Delta: chat.Message{Role: "assistant", Content: "Hello"}}},
+				}}
+				// the final chunk carries the usage of the whole completion
+				stream <- &chat.ChatStreamResponse{Response: chat.ChatResponse{
+					ID:    "some-id",
+					XGroq: &chat.XGroq{ID: "req-1", Usage: &chat.Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17}},
+				}}
+			}()
+			return stream, func() {}, nil
+		},
+	}
+
+	usage := persistence.NewInMemoryUsageStore()
+	server := &Handler{
+		groqClient: mockClient,
+		logger:     l,
+		db:         persistence.NewInMemoryStore(),
+		usage:      usage,
+		cfg:        testConfig(func(c *config.Config) { c.Quota.Daily = 20 }),
+		pricing:    chat.Pricing{chat.ModelIDLLAMA38B: {Prompt: 1, Completion: 2}},
+	}
+
+	var w *httptest.ResponseRecorder
+	send := func() int {
+		jsonBody, _ := json.Marshal(ChatRequestBody{Messages: []ChatMessage{{Role: "user", Content: "Hello"}}})
+		req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBuffer(jsonBody))
+		req = req.WithContext(WithPrincipal(req.Context(), Principal{ID: "alice"}))
+		w = httptest.NewRecorder()
+		server.SendMessage(w, req)
+		return w.Code
+	}
+
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	want := "event: usage\ndata: {\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":5,\"total_tokens\":17,\"prompt_time\":0,\"completion_time\":0,\"total_time\":0},\"cost\":0.000022}\n\n"
+	if !strings.HasSuffix(w.Body.String(), want) {
+		t.Fatalf("expected the stream to end with the usage event, got %q", w.Body.String())
+	}
+	if sent.StreamOptions == nil || !sent.StreamOptions.IncludeUsage {
+		t.Fatal("expected the stream to request usage")
+	}
+
+	got, _ := usage.GetUsage("alice", time.Now(), time.Now())
+	if len(got) != 1 || got[0].Model != string(chat.ModelIDLLAMA38B) || got[0].Requests != 1 || got[0].PromptTokens != 12 || got[0].CompletionTokens != 5 || got[0].Cost != 0.000022 {
+		t.Fatalf("unexpected usage: %+v", got)
+	}
+
+	// 17 of 20 tokens are used, the quota isn't exhausted yet
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	if code := send(); code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 once the quota is used up, got %d", code)
+	}
+}
+
+func TestGetUsage(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+	usage := persistence.NewInMemoryUsageStore()
+	server := &Handler{
+		logger: l,
+		usage:  usage,
+		cfg:    testConfig(func(c *config.Config) { c.Quota.Monthly = 1000 }),
+	}
+
+	day := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	usage.AddUsage(day, persistence.Usage{Owner: "alice", Model: "llama3-8b-8192", Requests: 1, PromptTokens: 10, CompletionTokens: 5})
+	usage.AddUsage(day, persistence.Usage{Owner: "alice", Model: "llama3-70b-8192", Requests: 1, PromptTokens: 20, CompletionTokens: 10})
+	usage.AddUsage(day.AddDate(0, 0, 1), persistence.Usage{Owner: "alice", Model: "llama3-8b-8192", Requests: 1, PromptTokens: 1, CompletionTokens: 1})
+	usage.AddUsage(day, persistence.Usage{Owner: "bob", Model: "llama3-8b-8192", Requests: 1, PromptTokens: 100, CompletionTokens: 100})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/usage"+query, nil)
+		req = req.WithContext(WithPrincipal(req.Context(), Principal{ID: "alice"}))
+		w := httptest.NewRecorder()
+		server.GetUsage(w, req)
+		return w
+	}
+
+	w := get("?from=2024-03-10&to=2024-03-10")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var body UsageBody
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(body.Usage) != 2 || body.Usage[0].Model != "llama3-70b-8192" {
+		t.Fatalf("expected usage of both models on the day, got %+v", body.Usage)
+	}
+	want := UsageTotals{Requests: 2, PromptTokens: 30, CompletionTokens: 15, TotalTokens: 45}
+	if body.Total != want {
+		t.Fatalf("expected totals %+v, got %+v", want, body.Total)
+	}
+	if body.Quota.Monthly != 1000 {
+		t.Fatalf("expected the quota to be reported, got %+v", body.Quota)
+	}
+
+	for _, query := range []string{"?from=yesterday", "?from=2024-03-10&to=2024-03-01", "?from=2020-01-01&to=2024-01-01"} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400 for %s, got %d", query, w.Code)
+		}
+	}
+}
+
+type alertRecorder struct {
+	mu     sync.Mutex
+	alerts []BudgetAlert
+	done   chan struct{}
+}
+
+func (a *alertRecorder) Alert(ctx context.Context, alert BudgetAlert) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.alerts = append(a.alerts, alert)
+	a.done <- struct{}{}
+	return nil
+}
+
+func TestRecordUsage_BudgetAlert(t *testing.T) {
+	buf := &strings.Builder{}
+	logger.SetOutput(buf)
+	defer logger.SetOutput(nil)
+
+	alerter := &alertRecorder{done: make(chan struct{}, 1)}
+	server := &Handler{
+		logger:  logger.Info,
+		usage:   persistence.NewInMemoryUsageStore(),
+		pricing: chat.Pricing{chat.ModelIDLLAMA38B: {Prompt: 1e6, Completion: 0}}, // a dollar per prompt token
+		cfg:     testConfig(func(c *config.Config) { c.Budget.MonthlyUSD = 100 }),
+		alerter: alerter,
+	}
+
+	alice := WithPrincipal(context.Background(), Principal{ID: "alice", Name: "laptop", Method: "api_key", Budget: 5})
+	bob := WithPrincipal(context.Background(), Principal{ID: "bob", Method: "jwt"})
+
+	server.recordUsage(alice, chat.ModelIDLLAMA38B, chat.Usage{PromptTokens: 3})
+	server.recordUsage(bob, chat.ModelIDLLAMA38B, chat.Usage{PromptTokens: 6})
+	select {
+	case <-alerter.done:
+		t.Fatal("expected no alert below the budget")
+	default:
+	}
+
+	// alice's key has its own budget of $5, the crossing request alerts once
+	server.recordUsage(alice, chat.ModelIDLLAMA38B, chat.Usage{PromptTokens: 3})
+	server.recordUsage(alice, chat.ModelIDLLAMA38B, chat.Usage{PromptTokens: 3})
+	select {
+	case <-alerter.done:
+	case <-time.After(time.Second):
+		t.Fatal("expected a budget alert")
+	}
+
+	alerter.mu.Lock()
+	defer alerter.mu.Unlock()
+	if len(alerter.alerts) != 1 {
+		t.Fatalf("expected a single alert, got %+v", alerter.alerts)
+	}
+	if a := alerter.alerts[0]; a.Owner != "alice" || a.Key != "laptop" || a.Budget != 5 || a.Spent != 6 {
+		t.Fatalf("unexpected alert: %+v", a)
+	}
+	if !strings.Contains(buf.String(), `level=WARN msg="budget crossed" owner=alice`) {
+		t.Fatalf("expected the alert to be logged, got %q", buf.String())
+	}
+}
+
+func TestRecordUsage_ConcurrentCrossing(t *testing.T) {
+	alerter := &alertRecorder{done: make(chan struct{}, 1)}
+	usage := persistence.NewInMemoryUsageStore()
+	server := &Handler{
+		logger:  logger.NewText(io.Discard),
+		usage:   usage,
+		pricing: chat.Pricing{chat.ModelIDLLAMA38B: {Prompt: 1e6, Completion: 0}},
+		alerter: alerter,
+	}
+	alice := WithPrincipal(context.Background(), Principal{ID: "alice", Name: "laptop", Method: "api_key", Budget: 5})
+
+	// $7 spent, $3 of which by a concurrent request that crossed the budget
+	// but hasn't checked it yet
+	usage.AddUsage(time.Now(), persistence.Usage{Owner: "alice", Key: "api_key:laptop", Model: string(chat.ModelIDLLAMA38B), Cost: 7})
+	server.recordUsage(alice, chat.ModelIDLLAMA38B, chat.Usage{PromptTokens: 3})
+
+	select {
+	case <-alerter.done:
+	case <-time.After(time.Second):
+		t.Fatal("expected a budget alert")
+	}
+}
+
+func TestRecordUsage_KeyBudget(t *testing.T) {
+	alerter := &alertRecorder{done: make(chan struct{}, 2)}
+	server := &Handler{
+		logger:  logger.NewText(io.Discard),
+		usage:   persistence.NewInMemoryUsageStore(),
+		pricing: chat.Pricing{chat.ModelIDLLAMA38B: {Prompt: 1e6, Completion: 0}},
+		alerter: alerter,
+	}
+	laptop := WithPrincipal(context.Background(), Principal{ID: "alice", Name: "laptop", Method: "api_key", Budget: 5})
+	ci := WithPrincipal(context.Background(), Principal{ID: "alice", Name: "ci", Method: "api_key", Budget: 50})
+
+	// alice spends $20 with ci, which doesn't count towards the laptop key
+	server.recordUsage(ci, chat.ModelIDLLAMA38B, chat.Usage{PromptTokens: 20})
+	server.recordUsage(laptop, chat.ModelIDLLAMA38B, chat.Usage{PromptTokens: 1})
+	select {
+	case <-alerter.done:
+		t.Fatal("expected no alert below the budgets of the keys")
+	default:
+	}
+
+	server.recordUsage(laptop, chat.ModelIDLLAMA38B, chat.Usage{PromptTokens: 4})
+	select {
+	case <-alerter.done:
+	case <-time.After(time.Second):
+		t.Fatal("expected a budget alert")
+	}
+	alerter.mu.Lock()
+	defer alerter.mu.Unlock()
+	if a := alerter.alerts[0]; a.Key != "laptop" || a.Spent != 5 {
+		t.Fatalf("expected the spend of the laptop key, got %+v", a)
+	}
+}
+
+func TestBudgetAlerts(t *testing.T) {
+	var a budgetAlerts
+	if !a.first("2024-03", "alice/") || a.first("2024-03", "alice/") {
+		t.Fatal("expected a budget to alert once a month")
+	}
+	if !a.first("2024-04", "alice/") || len(a.seen) != 1 {
+		t.Fatalf("expected the alerts of the previous month to be forgotten, got %v", a.seen)
+	}
+	if a.first("2024-03", "bob/") {
+		t.Fatal("expected no alert for a month that is over")
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"stream/internal/chat"
+	"strings"
+)
+
+// Sampling defaults used when the client leaves the parameter out.
+const (
+	defaultTemperature = 0.7
+	defaultTopP        = 0.85
+)
+
+// Bounds for the sampling parameters accepted by /chat.
+const (
+	maxTemperature   = 2.0
+	maxTopP          = 1.0
+	maxPenalty       = 2.0
+	maxStopSequences = 4
+	maxStopLength    = 256
+	maxUserIDLength  = 256
+	maxChoices       = 8
+)
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when one or more request fields are invalid.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Field, f.Message))
+	}
+	return "invalid request: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidationErrorBody is the 400 response body listing every invalid field.
+type ValidationErrorBody struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+}
+
+func writeValidationError(w http.ResponseWriter, err *ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ValidationErrorBody{
+		Error:  "invalid request",
+		Fields: err.Fields,
+	})
+}
+
+// validate checks the sampling parameters and message content of the body
+// against the limits of model.
+// It returns nil when every field is valid.
+func (b ChatRequestBody) validate(model chat.ModelID) *ValidationError {
+	verr := &ValidationError{}
+
+	limits, ok := model.Limits()
+	if !ok {
+		verr.add("model", "unknown model %q", model)
+	}
+
+	if b.Temperature != nil && (*b.Temperature < 0 || *b.Temperature > maxTemperature) {
+		verr.add("temperature", "must be between 0 and %g, got %g", maxTemperature, *b.Temperature)
+	}
+	if b.TopP != nil && (*b.TopP < 0 || *b.TopP > maxTopP) {
+		verr.add("top_p", "must be between 0 and %g, got %g", maxTopP, *b.TopP)
+	}
+	if b.MaxTokens != nil {
+		switch {
+		case *b.MaxTokens < 1:
+			verr.add("max_tokens", "must be at least 1, got %d", *b.MaxTokens)
+		case ok && *b.MaxTokens > limits.MaxCompletionTokens:
+			verr.add("max_tokens", "must be at most %d for model %s, got %d", limits.MaxCompletionTokens, model, *b.MaxTokens)
+		}
+	}
+	if b.Seed != nil && *b.Seed < 0 {
+		verr.add("seed", "must not be negative, got %d", *b.Seed)
+	}
+	if b.PresencePenalty < -maxPenalty || b.PresencePenalty > maxPenalty {
+		verr.add("presence_penalty", "must be between %g and %g, got %g", -maxPenalty, maxPenalty, b.PresencePenalty)
+	}
+	if b.FrequencyPenalty < -maxPenalty || b.FrequencyPenalty > maxPenalty {
+		verr.add("frequency_penalty", "must be between %g and %g, got %g", -maxPenalty, maxPenalty, b.FrequencyPenalty)
+	}
+	if len(b.Stop) > maxStopSequences {
+		verr.add("stop", "must contain at most %d sequences, got %d", maxStopSequences, len(b.Stop))
+	}
+	for i, s := range b.Stop {
+		if s == "" || len(s) > maxStopLength {
+			verr.add(fmt.Sprintf("stop[%d]", i), "must be between 1 and %d bytes long", maxStopLength)
+		}
+	}
+	if len(b.UserID) > maxUserIDLength {
+		verr.add("user", "must be at most %d characters long", maxUserIDLength)
+	}
+	if b.N != nil && (*b.N < 1 || *b.N > maxChoices) {
+		verr.add("n", "must be between 1 and %d, got %d", maxChoices, *b.N)
+	}
+	if b.N != nil && *b.N > 1 && b.RetryOnInvalid {
+		verr.add("retry_on_invalid", "is only supported with n = 1")
+	}
+	if _, err := newOutputValidator(b.ResponseFormat); err != nil {
+		verr.add("response_format", "%v", err)
+	}
+	validateParts(b.Messages, model, verr)
+
+	if len(verr.Fields) == 0 {
+		return nil
+	}
+	return verr
+}
+
+// applySampling copies the sampling parameters of the body onto req, falling
+// back to the service defaults for the ones the client didn't set.
+func (b ChatRequestBody) applySampling(req *chat.ChatRequest) {
+	temperature, topP := defaultTemperature, defaultTopP
+	if b.Temperature != nil {
+		temperature = *b.Temperature
+	}
+	if b.TopP != nil {
+		topP = *b.TopP
+	}
+
+	req.Temperature = &temperature
+	req.TopP = &topP
+	if b.MaxTokens != nil {
+		req.MaxTokens = *b.MaxTokens
+	}
+	req.Seed = b.Seed
+	req.Stop = b.Stop
+	req.PresencePenalty = b.PresencePenalty
+	req.FrequencyPenalty = b.FrequencyPenalty
+	req.UserID = b.UserID
+	if b.N != nil {
+		req.N = *b.N
+	}
+}
+
+// StopSequences are the stop sequences of a request, sent either as an array
+// of strings or, like OpenAI accepts, as a single string.
+type StopSequences []string
+
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = StopSequences{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("stop must be a string or an array of strings")
+	}
+	*s = many
+	return nil
+}
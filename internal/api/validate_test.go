@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"stream/internal/chat"
+	"stream/pkg/logger"
+	"testing"
+)
+
+func TestChatRequestBody_Validate(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	i := func(v int) *int { return &v }
+
+	tests := []struct {
+		name   string
+		body   ChatRequestBody
+		model  chat.ModelID
+		fields []string
+	}{
+		{"defaults", ChatRequestBody{}, chat.ModelIDLLAMA38B, nil},
+		{"all valid", ChatRequestBody{Temperature: f(0), TopP: f(1), MaxTokens: i(8192), Seed: i(42), Stop: []string{"\n"}, PresencePenalty: -2, FrequencyPenalty: 2}, chat.ModelIDLLAMA38B, nil},
+		{"unknown model", ChatRequestBody{}, "gpt-9", []string{"model"}},
+		{"out of range", ChatRequestBody{Temperature: f(2.5), TopP: f(-0.1), PresencePenalty: 3, FrequencyPenalty: -3, Seed: i(-1)}, chat.ModelIDLLAMA38B, []string{"temperature", "top_p", "seed", "presence_penalty", "frequency_penalty"}},
+		{"max tokens above model limit", ChatRequestBody{MaxTokens: i(9000)}, chat.ModelIDGEMMA, []string{"max_tokens"}},
+		{"max tokens within larger limit", ChatRequestBody{MaxTokens: i(9000)}, chat.ModelIDMIXTRAL, nil},
+		{"zero max tokens", ChatRequestBody{MaxTokens: i(0)}, chat.ModelIDMIXTRAL, []string{"max_tokens"}},
+		{"stop sequences", ChatRequestBody{Stop: []string{"a", "b", "", "d", "e"}}, chat.ModelIDLLAMA38B, []string{"stop", "stop[2]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verr := tt.body.validate(tt.model)
+			if tt.fields == nil {
+				if verr != nil {
+					t.Fatalf("expected no error, got %v", verr)
+				}
+				return
+			}
+			if verr == nil {
+				t.Fatalf("expected errors for %v, got none", tt.fields)
+			}
+
+			var got []string
+			for _, fe := range verr.Fields {
+				got = append(got, fe.Field)
+			}
+			if len(got) != len(tt.fields) {
+				t.Fatalf("expected fields %v, got %v", tt.fields, got)
+			}
+			for i := range got {
+				if got[i] != tt.fields[i] {
+					t.Fatalf("expected fields %v, got %v", tt.fields, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSendMessage_InvalidSampling(t *testing.T) {
+	l := logger.NewStdLogger(log.Default())
+	server := &Handler{
+		logger: l,
+	}
+
+	jsonBody := []byte(`{"messages":[{"role":"user","content":"Hi"}],"temperature":5,"top_p":2}`)
+	req := httptest.NewRequest(http.MethodPost, "/chat", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	server.SendMessage(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", res.StatusCode)
+	}
+
+	var body ValidationErrorBody
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(body.Fields) != 2 || body.Fields[0].Field != "temperature" || body.Fields[1].Field != "top_p" {
+		t.Fatalf("expected temperature and top_p to be reported, got %+v", body.Fields)
+	}
+}
+
+func TestStopSequences_Unmarshal(t *testing.T) {
+	for body, want := range map[string][]string{
+		`{"stop":"\n"}`:      {"\n"},
+		`{"stop":["a","b"]}`: {"a", "b"},
+		`{"messages":[]}`:    nil,
+	} {
+		var b ChatRequestBody
+		if err := json.Unmarshal([]byte(body), &b); err != nil {
+			t.Fatalf("%s: %v", body, err)
+		}
+		if !slices.Equal(b.Stop, want) {
+			t.Errorf("%s: got stop %q; want %q", body, b.Stop, want)
+		}
+	}
+	var b ChatRequestBody
+	if err := json.Unmarshal([]byte(`{"stop":1}`), &b); err == nil {
+		t.Error("expected a stop that is neither a string nor an array to fail")
+	}
+}
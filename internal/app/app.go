@@ -2,74 +2,132 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
-	"log/slog"
+	"net"
 	"net/http"
 	"stream/internal/api"
+	"stream/internal/audit"
+	"stream/internal/config"
+	"stream/internal/metrics"
 	"stream/internal/persistence"
+	"stream/internal/tracing"
 	"stream/pkg/logger"
 	"time"
 )
 
 type App struct {
-	logger logger.Logger
-	router *http.ServeMux
-	db     persistence.ConversationStore
+	logger  logger.Structured
+	cfg     *config.Live
+	router  *http.ServeMux
+	db      persistence.ConversationStore
+	images  persistence.ImageStore
+	acct    api.Accounting
+	auth    api.Middleware
+	limit   api.Middleware
+	limitIP api.Middleware // Applied before auth
+	metrics *metrics.Metrics
+	tracer  *tracing.Tracer
+	audit   *audit.Trail
 }
 
-func New(logger logger.Logger, db persistence.ConversationStore) *App {
+func New(logger logger.Structured, cfg *config.Live, db persistence.ConversationStore, images persistence.ImageStore, acct api.Accounting, auth, limit, limitIP api.Middleware, m *metrics.Metrics, t *tracing.Tracer, trail *audit.Trail) *App {
 	return &App{
-		logger: logger,
-		router: http.NewServeMux(),
-		db:     db,
+		logger:  logger,
+		cfg:     cfg,
+		router:  http.NewServeMux(),
+		db:      db,
+		images:  images,
+		acct:    acct,
+		auth:    auth,
+		limit:   limit,
+		limitIP: limitIP,
+		metrics: m,
+		tracer:  t,
+		audit:   trail,
 	}
 }
 
-func withCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 func (a *App) Run(ctx context.Context) error {
 
-	handler := api.NewHandler(a.logger, a.db)
+	handler := api.NewHandler(a.logger, a.cfg, a.db, a.images, a.acct, a.metrics, a.tracer, a.audit)
 
 	a.reloadRoutes(handler)
 
+	cfg := a.cfg.Get()
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: withCORS(api.Logging(a.logger, a.router)),
+		Handler:           api.CORS(cfg.CORS)(api.Logging(a.logger, api.Tracing(a.tracer)(api.Instrument(a.metrics)(a.router)))),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		// WriteTimeout is set per route, see reloadRoutes, so it can't cut
+		// streams short
+	}
+	if cfg.Server.H2C {
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetHTTP2(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
 	}
 
-	done := make(chan struct{})
+	serve := server.Serve
+	if cfg.Server.TLSCertFile != "" {
+		certs, err := newCertReloader(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile, func(err error) {
+			a.logger.Warn("keeping the previous TLS certificate", "error", err)
+		})
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate, MinVersion: tls.VersionTLS12}
+		serve = func(l net.Listener) error { return server.ServeTLS(l, "", "") }
+	}
+
+	l, err := listen(cfg.Addr)
+	if err != nil {
+		return err
+	}
+
+	// Serve changes TLSConfig, read it before
+	useTLS := server.TLSConfig != nil
+	errc := make(chan error, 1)
 	go func() {
-		err := server.ListenAndServe()
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			a.logger.Fatalf("server error", slog.Any("Error", err))
+		err := serve(l)
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
 		}
-		close(done)
+		errc <- err
 	}()
 
-	a.logger.Printf("server started", slog.String("address", server.Addr))
+	a.logger.Info("server started", "address", cfg.Addr, "tls", useTLS, "h2c", cfg.Server.H2C)
 
 	select {
-	case <-done:
-		break
+	case err := <-errc:
+		return err
 
 	case <-ctx.Done():
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		server.Shutdown(ctx)
-		cancel()
+		// readiness fails and requests are refused from now on, streams in
+		// progress get DRAIN_TIMEOUT to finish
+		cfg := a.cfg.Get()
+		a.logger.Info("shutting down", "drain_timeout", cfg.DrainTimeout, "readiness_grace", cfg.ReadinessGrace)
+		deadline := time.Now().Add(cfg.DrainTimeout + cfg.ShutdownTimeout)
+		handler.Drain(cfg.DrainTimeout)
+
+		// Shutdown closes the listener, keep it open until load balancers
+		// had the time to see readiness fail
+		select {
+		case <-time.After(cfg.ReadinessGrace):
+		case err := <-errc:
+			return err
+		}
+
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			a.logger.Warn("requests still in progress at shutdown", "error", err)
+		}
+		if err := handler.Flush(ctx); err != nil {
+			a.logger.Warn("conversations not saved at shutdown", "error", err)
+		}
 	}
 
 	return nil
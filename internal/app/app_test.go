@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"stream/internal/api"
+	"stream/internal/config"
+	"stream/internal/metrics"
+	"stream/internal/persistence"
+	"stream/pkg/logger"
+	"testing"
+	"time"
+)
+
+func TestRun_ReadinessGrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.sock")
+	cfg := config.Defaults()
+	cfg.Addr = "unix:" + path
+	cfg.GroqAPIKey = "key"
+	cfg.DrainTimeout, cfg.ReadinessGrace = time.Second, 200*time.Millisecond
+
+	none := func(h http.Handler) http.Handler { return h }
+	a := New(logger.NewText(io.Discard), config.NewLive(logger.Info, cfg, nil), persistence.NewInMemoryStore(), persistence.NewInMemoryImageStore(0), api.Accounting{}, none, none, none, metrics.New(), nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- a.Run(ctx) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+		DisableKeepAlives: true,
+	}}
+	readyz := func() (int, error) {
+		res, err := client.Get("http://stream/readyz")
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+		return res.StatusCode, nil
+	}
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if code, err := readyz(); err == nil {
+			if code != http.StatusOK {
+				t.Fatalf("readiness got %d before the shutdown; want 200", code)
+			}
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("server didn't start")
+		}
+	}
+
+	// load balancers see readiness fail before the listener is closed
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	if code, err := readyz(); err != nil || code != http.StatusServiceUnavailable {
+		t.Errorf("readiness got %d, %v during the grace period; want 503", code, err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't shut down")
+	}
+}
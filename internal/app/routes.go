@@ -1,13 +1,43 @@
 package app
 
 import (
+	"net/http"
 	"stream/internal/api"
+	"time"
 
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
 func (a *App) reloadRoutes(appHandler *api.Handler) {
-	a.router.HandleFunc("GET /swagger/*", httpSwagger.WrapHandler)
-	a.router.HandleFunc("GET /status", appHandler.Status)
-	a.router.HandleFunc("POST /chat", appHandler.SendMessage)
+	// auth requires a valid API key or JWT, its principal owns the conversations
+	// and is rate limited; it is refused once the server shuts down. Clients
+	// are limited by IP address before authentication, so bad credentials
+	// can't be tried at will
+	admins := func() []string { return a.cfg.Get().Admin.Users }
+	auth := func(h http.HandlerFunc) http.Handler {
+		return appHandler.RefuseWhenDraining(a.limitIP(a.auth(api.DebugLogging(admins)(a.limit(h)))))
+	}
+	// admin requires the principal to be one of ADMIN_USERS
+	admin := func(h http.HandlerFunc) http.Handler {
+		return appHandler.RefuseWhenDraining(a.limitIP(a.auth(api.RequireAdmin(a.logger, admins)(h))))
+	}
+
+	// responses get SERVER_WRITE_TIMEOUT to be written, chat responses may
+	// stream for minutes so each of their writes gets
+	// SERVER_STREAM_WRITE_TIMEOUT instead
+	timeout := api.WriteTimeout(func() time.Duration { return a.cfg.Get().Server.WriteTimeout })
+	stream := api.StreamWriteTimeout(func() time.Duration { return a.cfg.Get().Server.StreamWriteTimeout })
+
+	a.router.Handle("GET /swagger/*", timeout(httpSwagger.WrapHandler))
+	a.router.Handle("GET /status", timeout(http.HandlerFunc(appHandler.Status)))
+	a.router.Handle("GET /healthz", timeout(http.HandlerFunc(appHandler.Healthz)))
+	a.router.Handle("GET /readyz", timeout(http.HandlerFunc(appHandler.Readyz)))
+	a.router.Handle("GET /metrics", timeout(a.metrics.Registry.Handler()))
+	a.router.Handle("POST /chat", stream(auth(appHandler.SendMessage)))
+	a.router.Handle("POST /v1/chat/completions", stream(auth(appHandler.ChatCompletions)))
+	a.router.Handle("GET /images/{ref}", timeout(auth(appHandler.GetImage)))
+	a.router.Handle("POST /conversations/{id}/choice", timeout(auth(appHandler.SelectChoice)))
+	a.router.Handle("GET /usage", timeout(auth(appHandler.GetUsage)))
+	a.router.Handle("GET /admin/log-level", timeout(admin(appHandler.GetLogLevel)))
+	a.router.Handle("PUT /admin/log-level", timeout(admin(appHandler.SetLogLevel)))
 }
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/api"
+	"stream/internal/config"
+	"stream/internal/metrics"
+	"stream/internal/persistence"
+	"stream/internal/ratelimit"
+	"stream/pkg/logger"
+	"testing"
+)
+
+func TestRoutes_RateLimitBeforeAuth(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.RateLimit.IPPerMinute, cfg.RateLimit.IPBurst = 1, 3
+	live := config.NewLive(logger.Info, cfg, nil)
+
+	log := logger.NewText(io.Discard)
+	buckets := ratelimit.NewMemoryStore()
+	limiter := api.RateLimit(log, buckets, func() ratelimit.Limit { return ratelimit.PerMinute(cfg.RateLimit.PerMinute, cfg.RateLimit.Burst) })
+	ipLimiter := api.RateLimit(log, buckets, func() ratelimit.Limit { return ratelimit.PerMinute(cfg.RateLimit.IPPerMinute, cfg.RateLimit.IPBurst) })
+	keys := persistence.NewInMemoryAPIKeyStore()
+	m := metrics.New()
+
+	a := New(log, live, persistence.NewInMemoryStore(), persistence.NewInMemoryImageStore(0), api.Accounting{}, api.Authenticate(log, keys, nil), limiter, ipLimiter, m, nil, nil)
+	a.reloadRoutes(api.NewHandler(log, live, persistence.NewInMemoryStore(), persistence.NewInMemoryImageStore(0), api.Accounting{}, m, nil, nil))
+
+	var codes []int
+	for range 4 {
+		req := httptest.NewRequest(http.MethodGet, "/usage", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("Authorization", "Bearer guessed-key")
+		w := httptest.NewRecorder()
+		a.router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("got statuses %v for repeated bad tokens; want %v", codes, want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listen listens on addr, a TCP host:port or unix:/path/of.sock.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	// a socket left behind by a process that didn't exit cleanly is in the way
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// certCheckInterval is how often the certificate files are checked for
+// changes.
+const certCheckInterval = 10 * time.Second
+
+// certReloader serves the certificate of a pair of PEM files and loads it
+// again when either file changes, so renewed certificates are used without a
+// restart.
+type certReloader struct {
+	certFile, keyFile string
+	onError           func(error) // Called when a changed pair fails to load
+	interval          time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time // Of the most recently changed file tried
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile string, onError func(error)) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, onError: onError, interval: certCheckInterval}
+	modTime, err := r.modified()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.modTime, r.checkedAt = modTime, time.Now()
+	return r, nil
+}
+
+// GetCertificate is the tls.Config hook returning the certificate to present.
+// The files are checked at most once per interval, not on every handshake.
+// A changed pair that fails to load, such as a certificate written before its
+// key, is reported once and the previous certificate is kept until the files
+// change again.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now := time.Now(); now.Sub(r.checkedAt) >= r.interval {
+		r.checkedAt = now
+		modTime, err := r.modified()
+		if err == nil && modTime.After(r.modTime) {
+			r.modTime = modTime
+			err = r.load()
+		}
+		if err != nil {
+			r.onError(err)
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	r.cert = &cert
+	return nil
+}
+
+// modified returns when the certificate or the key last changed.
+func (r *certReloader) modified() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to check TLS certificate: %w", err)
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for name and its key.
+func writeCert(t *testing.T, certFile, keyFile, name string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	now := time.Now()
+	writeCert(t, certFile, keyFile, "old.example.com", now.Add(-time.Minute))
+
+	var errs []error
+	r, err := newCertReloader(certFile, keyFile, func(err error) { errs = append(errs, err) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.interval = 0
+	name := func() string {
+		cert, err := r.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+	if got := name(); got != "old.example.com" {
+		t.Fatalf("got certificate of %s; want old.example.com", got)
+	}
+
+	// a certificate written without its key yet keeps the previous one
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	name()
+	if got := name(); got != "old.example.com" || len(errs) != 1 {
+		t.Errorf("got certificate of %s and %d errors after a broken renewal; want old.example.com and 1", got, len(errs))
+	}
+
+	writeCert(t, certFile, keyFile, "new.example.com", now.Add(time.Minute))
+	if got := name(); got != "new.example.com" {
+		t.Errorf("got certificate of %s after a renewal; want new.example.com", got)
+	}
+}
+
+func TestListen_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.sock")
+	l, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// like a crash, leave the socket behind
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	if l, err = listen("unix:" + path); err != nil {
+		t.Fatalf("failed to listen over a stale socket: %v", err)
+	}
+	defer l.Close()
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go server.Serve(l)
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	res, err := client.Get("http://stream/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+}
+
+func TestCertReloader_Interval(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCert(t, certFile, keyFile, "old.example.com", time.Now().Add(-time.Minute))
+	r, err := newCertReloader(certFile, keyFile, func(err error) { t.Error(err) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, _ := r.GetCertificate(nil)
+
+	// renewed within the interval, the files aren't checked yet
+	writeCert(t, certFile, keyFile, "new.example.com", time.Now())
+	if cert, _ := r.GetCertificate(nil); cert != old {
+		t.Error("certificate reloaded before the check interval")
+	}
+	r.mu.Lock()
+	r.checkedAt = r.checkedAt.Add(-certCheckInterval)
+	r.mu.Unlock()
+	if cert, _ := r.GetCertificate(nil); cert == old {
+		t.Error("certificate not reloaded after the check interval")
+	}
+}
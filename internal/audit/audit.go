@@ -0,0 +1,110 @@
+// Package audit keeps an append-only trail of the chat exchanges served,
+// apart from the service logs.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Message is a message of an audited prompt.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Completion is a choice generated for an audited prompt.
+type Completion struct {
+	Index        int    `json:"index"`
+	Content      string `json:"content"`
+	FinishReason string `json:"finish_reason,omitempty"`
+}
+
+// Usage is the token usage of an exchange.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Record is an audited exchange.
+type Record struct {
+	Time           time.Time    `json:"time"`
+	RequestID      string       `json:"request_id,omitempty"`
+	User           string       `json:"user"`
+	Endpoint       string       `json:"endpoint"`
+	Model          string       `json:"model"`
+	ConversationID string       `json:"conversation_id,omitempty"`
+	Stream         bool         `json:"stream"`
+	Prompt         []Message    `json:"prompt"`
+	Completions    []Completion `json:"completions"`
+	Usage          Usage        `json:"usage"`
+	LatencyMS      int64        `json:"latency_ms"` // From the request to the end of the completion
+}
+
+// Options tell how content is written to the trail.
+type Options struct {
+	Redactor *Redactor // Applied to the content of prompts and completions
+	// HashContent replaces the content of prompts and completions by its
+	// SHA-256, as "sha256:<hex>", so exchanges can be matched against known
+	// text without being kept. The redactor is not used then.
+	HashContent bool
+}
+
+// Trail writes records as JSON lines to a writer, which should only append,
+// such as a file opened with O_APPEND. The methods of a nil *Trail do
+// nothing, so callers don't need to check whether auditing is on.
+type Trail struct {
+	opts Options
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func New(w io.Writer, opts Options) *Trail {
+	return &Trail{opts: opts, w: w}
+}
+
+// Record writes rec to the trail, after redacting or hashing its content.
+func (t *Trail) Record(rec Record) error {
+	if t == nil {
+		return nil
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	rec.Time = rec.Time.UTC()
+
+	prompt := make([]Message, len(rec.Prompt))
+	for i, m := range rec.Prompt {
+		prompt[i] = Message{Role: m.Role, Content: t.content(m.Content)}
+	}
+	rec.Prompt = prompt
+	completions := make([]Completion, len(rec.Completions))
+	for i, c := range rec.Completions {
+		c.Content = t.content(c.Content)
+		completions[i] = c
+	}
+	rec.Completions = completions
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.w.Write(append(line, '\n'))
+	return err
+}
+
+func (t *Trail) content(s string) string {
+	if t.opts.HashContent {
+		sum := sha256.Sum256([]byte(s))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return t.opts.Redactor.Redact(s)
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// rule replaces the text matching a pattern with a placeholder.
+type rule struct {
+	pattern     *regexp.Regexp
+	placeholder string
+}
+
+// builtinRules are the patterns of the built-in redaction rules, by name.
+var builtinRules = map[string]string{
+	"api_key": `\b(?:sk|gsk|pk|rk|xai)[-_][A-Za-z0-9_-]{16,}|\bAKIA[0-9A-Z]{16}\b|\b[Bb]earer\s+[A-Za-z0-9._~+/-]{16,}=*`,
+	"email":   `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"phone":   `\+?\d[\d\s().-]{7,}\d`,
+}
+
+// ruleOrder is the order rules are applied in. API keys go first, as they
+// may contain what looks like a phone number.
+var ruleOrder = []string{"api_key", "email", "phone"}
+
+// Redactor removes personal data and secrets from text before it is audited.
+// A nil *Redactor leaves text as is.
+type Redactor struct {
+	rules []rule
+}
+
+// NewRedactor returns a redactor applying the built-in rules named in names,
+// and pattern, a regular expression of more text to redact, if not empty.
+func NewRedactor(names []string, pattern string) (*Redactor, error) {
+	enabled := make(map[string]bool)
+	for _, name := range names {
+		if _, ok := builtinRules[name]; !ok {
+			return nil, fmt.Errorf("unknown redaction rule %q", name)
+		}
+		enabled[name] = true
+	}
+
+	r := &Redactor{}
+	for _, name := range ruleOrder {
+		if enabled[name] {
+			r.rules = append(r.rules, rule{regexp.MustCompile(builtinRules[name]), "[" + name + "]"})
+		}
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern: %w", err)
+		}
+		r.rules = append(r.rules, rule{re, "[redacted]"})
+	}
+	return r, nil
+}
+
+// Redact returns s with the text matching any rule replaced by the rule's
+// placeholder, such as [email].
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, rule := range r.rules {
+		s = rule.pattern.ReplaceAllLiteralString(s, rule.placeholder)
+	}
+	return s
+}
@@ -1,8 +1,12 @@
 package chat
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"stream/internal/tracing"
 )
 
 const (
@@ -11,29 +15,86 @@ const (
 
 type GroqClient interface {
 	SendMessage(ctx context.Context, req ChatRequest) (<-chan *ChatStreamResponse, func(), error)
+	Complete(ctx context.Context, req ChatRequest) (*ChatResponse, error)
 }
 
 // the DTOs for the Groq API
 type ChatRequest struct {
-	Messages       []Message `json:"messages"`                  // A list of messages comprising the conversation so far.
-	Stream         bool      `json:"stream,omitempty"`          // If set, partial message deltas will be sent as data-only server-sent events
-	Model          ModelID   `json:"model"`                     // The model to use for the chat completion.
-	MaxTokens      int       `json:"max_tokens,omitempty"`      // The maximum number of tokens that can be generated in the chat completion.
-	Temperature    float64   `json:"temperature,omitempty"`     // Sampling temperature
-	TopP           float64   `json:"top_p,omitempty"`           // Nucleus sampling probability
-	UserID         string    `json:"user,omitempty"`            // Unique identifier for the end-user
-	ResponseFormat any       `json:"response_format,omitempty"` // Format of the model's response
-	Seed           int       `json:"seed,omitempty"`            // Seed for deterministic sampling
+	Messages         []Message       `json:"messages"`                    // A list of messages comprising the conversation so far.
+	Stream           bool            `json:"stream,omitempty"`            // If set, partial message deltas will be sent as data-only server-sent events
+	Model            ModelID         `json:"model"`                       // The model to use for the chat completion.
+	MaxTokens        int             `json:"max_tokens,omitempty"`        // The maximum number of tokens that can be generated in the chat completion.
+	Temperature      *float64        `json:"temperature,omitempty"`       // Sampling temperature
+	TopP             *float64        `json:"top_p,omitempty"`             // Nucleus sampling probability
+	PresencePenalty  float64         `json:"presence_penalty,omitempty"`  // Penalty for tokens that already appeared in the text
+	FrequencyPenalty float64         `json:"frequency_penalty,omitempty"` // Penalty proportional to how often a token appeared
+	Stop             []string        `json:"stop,omitempty"`              // Sequences where the API will stop generating further tokens
+	UserID           string          `json:"user,omitempty"`              // Unique identifier for the end-user
+	ResponseFormat   *ResponseFormat `json:"response_format,omitempty"`   // Format of the model's response
+	Seed             *int            `json:"seed,omitempty"`              // Seed for deterministic sampling
+	N                int             `json:"n,omitempty"`                 // How many choices to generate for each input message
+	StreamOptions    *StreamOptions  `json:"stream_options,omitempty"`    // Options for streaming responses
+
+	// Raw, when set, is sent to the API as the request body instead of the
+	// fields above. It lets the OpenAI-compatible proxy forward requests untouched.
+	Raw json.RawMessage `json:"-"`
+}
+
+// StreamOptions configures streamed responses.
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"` // Send the token usage in a final chunk
+}
+
+type ResponseFormatType string
+
+const (
+	ResponseFormatText       ResponseFormatType = "text"
+	ResponseFormatJSONObject ResponseFormatType = "json_object"
+	ResponseFormatJSONSchema ResponseFormatType = "json_schema"
+)
+
+// ResponseFormat constrains the format of the model's output.
+type ResponseFormat struct {
+	Type       ResponseFormatType `json:"type"`                  // One of "text", "json_object" or "json_schema"
+	JSONSchema *JSONSchema        `json:"json_schema,omitempty"` // Schema the output must follow, for "json_schema"
+}
+
+// JSONSchema describes the structure expected from a "json_schema" response format.
+type JSONSchema struct {
+	Name        string          `json:"name"`                  // Name of the schema
+	Description string          `json:"description,omitempty"` // What the output is for
+	Schema      json.RawMessage `json:"schema"`                // The JSON Schema document
+	Strict      bool            `json:"strict,omitempty"`      // Whether the output must follow the schema exactly
 }
 
 // ChatCompletionResponse represents the response from the chat completion API.
 type ChatResponse struct {
-	ID      string   `json:"id"`      // Unique identifier for the completion
-	Object  string   `json:"object"`  // Type of the object (e.g., "chat.completion")
-	Created int64    `json:"created"` // Timestamp of creation
-	Model   string   `json:"model"`   // ID of the model used
-	Choices []Choice `json:"choices"` // List of completion choices
-	Usage   Usage    `json:"usage"`   // Token usage information
+	ID      string   `json:"id"`               // Unique identifier for the completion
+	Object  string   `json:"object"`           // Type of the object (e.g., "chat.completion")
+	Created int64    `json:"created"`          // Timestamp of creation
+	Model   string   `json:"model"`            // ID of the model used
+	Choices []Choice `json:"choices"`          // List of completion choices
+	Usage   Usage    `json:"usage"`            // Token usage information
+	XGroq   *XGroq   `json:"x_groq,omitempty"` // Groq specific fields of stream chunks
+
+	Raw json.RawMessage `json:"-"` // The response (or stream chunk) exactly as received
+}
+
+// XGroq holds the Groq extensions of a stream chunk. The final chunk of a
+// stream carries the usage of the whole completion here.
+type XGroq struct {
+	ID    string `json:"id"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// StreamUsage returns the token usage reported by a stream chunk, either in
+// x_groq or, when stream_options.include_usage was requested, in usage. Only
+// the final chunk of a stream carries it.
+func (r *ChatResponse) StreamUsage() (Usage, bool) {
+	if r.XGroq != nil && r.XGroq.Usage != nil {
+		return *r.XGroq.Usage, true
+	}
+	return r.Usage, r.Usage.TotalTokens > 0
 }
 
 // Choice represents a single completion choice returned by the chat completion API.
@@ -69,3 +130,28 @@ func NewGroqClient(apiKey string) *groqClient {
 		HTTPClient: &http.Client{},
 	}
 }
+
+// newRequest builds the HTTP request for the chat completions endpoint.
+func (c *groqClient) newRequest(ctx context.Context, req ChatRequest) (*http.Request, error) {
+	url := fmt.Sprintf("%s/v1/chat/completions", c.BaseURL)
+
+	jsonData := []byte(req.Raw)
+	if jsonData == nil {
+		var err error
+		jsonData, err = json.Marshal(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %v", err)
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	httpReq.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, httpReq.Header)
+
+	return httpReq, nil
+}
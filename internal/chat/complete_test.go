@@ -0,0 +1,121 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stream/internal/tracing"
+	"testing"
+)
+
+func TestComplete_Success(t *testing.T) {
+	raw := `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}],"usage":{"total_tokens":7}}`
+
+	var gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(raw))
+	}))
+	defer server.Close()
+
+	client := &groqClient{
+		BaseURL: server.URL,
+		APIKey:  "fake-key",
+	}
+
+	resp, err := client.Complete(context.Background(), ChatRequest{
+		Model: ModelIDLLAMA38B,
+		Raw:   []byte(`{"model":"llama3-8b-8192","logprobs":true}`),
+	})
+	if err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+
+	if gotBody != `{"model":"llama3-8b-8192","logprobs":true}` {
+		t.Errorf("expected raw body to be sent, got %s", gotBody)
+	}
+	if resp.Choices[0].Message.Content != "Hello" || resp.Usage.TotalTokens != 7 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if string(resp.Raw) != raw {
+		t.Errorf("expected raw response to be kept, got %s", resp.Raw)
+	}
+}
+
+func TestComplete_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"slow down"}}`))
+	}))
+	defer server.Close()
+
+	client := &groqClient{
+		BaseURL: server.URL,
+		APIKey:  "fake-key",
+	}
+
+	_, err := client.Complete(context.Background(), ChatRequest{Model: ModelIDLLAMA38B})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected status 429, got %d", apiErr.StatusCode)
+	}
+}
+
+func TestComplete_Traceparent(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("traceparent")
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[]}`))
+	}))
+	defer server.Close()
+
+	client := &groqClient{
+		BaseURL: server.URL,
+		APIKey:  "fake-key",
+	}
+
+	tracer := tracing.NewTracer(tracing.NewInMemoryExporter())
+	ctx, span := tracer.Start(context.Background(), "test")
+	defer span.End()
+	if _, err := client.Complete(ctx, ChatRequest{Model: ModelIDLLAMA38B}); err != nil {
+		t.Fatalf("Complete returned error: %v", err)
+	}
+
+	if want := span.SpanContext().Traceparent(); got != want {
+		t.Errorf("traceparent = %q; want %q", got, want)
+	}
+}
+
+func TestPing(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer fake-key" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer server.Close()
+
+	client := &groqClient{
+		BaseURL: server.URL,
+		APIKey:  "fake-key",
+	}
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("Ping returned error: %v", err)
+	}
+
+	status = http.StatusUnauthorized
+	var apiErr *APIError
+	if err := client.Ping(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected *APIError with status 401, got %v", err)
+	}
+}
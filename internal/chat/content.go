@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type ContentPartType string
+
+const (
+	ContentPartText     ContentPartType = "text"
+	ContentPartImageURL ContentPartType = "image_url"
+)
+
+// ContentPart is one element of a multimodal message content array.
+type ContentPart struct {
+	Type     ContentPartType `json:"type"`                // Either "text" or "image_url"
+	Text     string          `json:"text,omitempty"`      // Text of a "text" part
+	ImageURL *ImageURL       `json:"image_url,omitempty"` // Image of an "image_url" part
+}
+
+// ImageURL points at an image, either over http(s) or inline as a base64 data URL.
+type ImageURL struct {
+	URL    string `json:"url"`              // http(s) URL or data:image/...;base64,... URL
+	Detail string `json:"detail,omitempty"` // Optional resolution hint: "low", "high" or "auto"
+}
+
+// HasImages reports whether any of the parts is an image.
+func HasImages(parts []ContentPart) bool {
+	for _, p := range parts {
+		if p.Type == ContentPartImageURL {
+			return true
+		}
+	}
+	return false
+}
+
+// PartsText joins the text of all text parts.
+func PartsText(parts []ContentPart) string {
+	var text string
+	for _, p := range parts {
+		if p.Type == ContentPartText {
+			text += p.Text
+		}
+	}
+	return text
+}
+
+// MarshalContent encodes message content the way the OpenAI API expects it:
+// a plain string, or an array of parts when parts are given.
+func MarshalContent(text string, parts []ContentPart) (json.RawMessage, error) {
+	if len(parts) > 0 {
+		return json.Marshal(parts)
+	}
+	return json.Marshal(text)
+}
+
+// UnmarshalContent decodes message content that is either a plain string or an
+// array of parts. For arrays, text holds the joined text of the parts.
+func UnmarshalContent(data json.RawMessage) (text string, parts []ContentPart, err error) {
+	if len(data) == 0 || string(data) == "null" {
+		return "", nil, nil
+	}
+
+	if err := json.Unmarshal(data, &text); err == nil {
+		return text, nil, nil
+	}
+
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return "", nil, fmt.Errorf("content must be a string or an array of content parts")
+	}
+	return PartsText(parts), parts, nil
+}
+
+// messageJSON is the wire representation of Message.
+type messageJSON struct {
+	Role    MessageRole     `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+func (m Message) MarshalJSON() ([]byte, error) {
+	content, err := MarshalContent(m.Content, m.Parts)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(messageJSON{Role: m.Role, Content: content})
+}
+
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var raw messageJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	text, parts, err := UnmarshalContent(raw.Content)
+	if err != nil {
+		return err
+	}
+
+	*m = Message{Role: raw.Role, Content: text, Parts: parts}
+	return nil
+}
@@ -0,0 +1,46 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessage_JSON(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{"text", Message{Role: MessageRoleUser, Content: "Hi"}, `{"role":"user","content":"Hi"}`},
+		{"parts", Message{Role: MessageRoleUser, Content: "What is this?", Parts: []ContentPart{
+			{Type: ContentPartText, Text: "What is this?"},
+			{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "https://example.com/cat.png"}},
+		}}, `{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.msg)
+			if err != nil {
+				t.Fatalf("Marshal returned error: %v", err)
+			}
+			if string(b) != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, b)
+			}
+
+			var got Message
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("Unmarshal returned error: %v", err)
+			}
+			if got.Content != tt.msg.Content || len(got.Parts) != len(tt.msg.Parts) {
+				t.Fatalf("round trip mismatch: %+v", got)
+			}
+		})
+	}
+}
+
+func TestUnmarshalContent_Invalid(t *testing.T) {
+	if _, _, err := UnmarshalContent(json.RawMessage(`42`)); err == nil {
+		t.Fatal("expected an error for numeric content")
+	}
+}
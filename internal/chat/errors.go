@@ -0,0 +1,30 @@
+package chat
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxErrorBodySize caps how much of an upstream error body is kept in memory.
+const maxErrorBodySize = 64 << 10
+
+// APIError is returned when the Groq API answers with a non-2xx status code.
+// The body is kept verbatim so it can be relayed to OpenAI-compatible clients.
+type APIError struct {
+	StatusCode int    // HTTP status code returned by the API
+	Body       []byte // Raw response body, usually an OpenAI-style error object
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("groq api returned %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// newAPIError drains the body of a failed response into an APIError.
+func newAPIError(res *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+	return &APIError{
+		StatusCode: res.StatusCode,
+		Body:       body,
+	}
+}
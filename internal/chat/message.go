@@ -6,6 +6,10 @@ type MessageRole string
 type Message struct {
 	Role    MessageRole `json:"role"`    // Role of the message sender (e.g., "user" or "assistant")
 	Content string      `json:"content"` // Content of the message
+
+	// Parts holds multimodal content (text and images). When set, the content
+	// is sent as an array of parts and Content is the joined text of the parts.
+	Parts []ContentPart `json:"-"`
 }
 
 const (
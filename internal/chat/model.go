@@ -7,4 +7,30 @@ const (
 	ModelIDLLAMA370B ModelID = "llama3-70b-8192"
 	ModelIDMIXTRAL   ModelID = "mixtral-8x7b-32768"
 	ModelIDGEMMA     ModelID = "gemma-7b-it"
+
+	ModelIDLLAMA3211BVision ModelID = "llama-3.2-11b-vision-preview"
+	ModelIDLLAMA3290BVision ModelID = "llama-3.2-90b-vision-preview"
 )
+
+// ModelLimits describes the bounds a model accepts in a chat request.
+type ModelLimits struct {
+	ContextWindow       int  // Maximum number of tokens for prompt and completion combined
+	MaxCompletionTokens int  // Maximum number of tokens the model can generate
+	Vision              bool // Whether the model accepts image content parts
+}
+
+var modelLimits = map[ModelID]ModelLimits{
+	ModelIDLLAMA38B:  {ContextWindow: 8192, MaxCompletionTokens: 8192},
+	ModelIDLLAMA370B: {ContextWindow: 8192, MaxCompletionTokens: 8192},
+	ModelIDMIXTRAL:   {ContextWindow: 32768, MaxCompletionTokens: 32768},
+	ModelIDGEMMA:     {ContextWindow: 8192, MaxCompletionTokens: 8192},
+
+	ModelIDLLAMA3211BVision: {ContextWindow: 8192, MaxCompletionTokens: 8192, Vision: true},
+	ModelIDLLAMA3290BVision: {ContextWindow: 8192, MaxCompletionTokens: 8192, Vision: true},
+}
+
+// Limits returns the limits of the model, and false if the model is unknown.
+func (m ModelID) Limits() (ModelLimits, bool) {
+	l, ok := modelLimits[m]
+	return l, ok
+}
@@ -0,0 +1,40 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Price is the cost of a model in USD per million tokens.
+type Price struct {
+	Prompt     float64 `json:"prompt"`     // Per million prompt tokens
+	Completion float64 `json:"completion"` // Per million completion tokens
+}
+
+// Pricing maps models to their price.
+type Pricing map[ModelID]Price
+
+// ParsePricing parses a pricing table, a JSON object of model IDs to prices:
+//
+//	{"llama3-8b-8192": {"prompt": 0.05, "completion": 0.08}}
+func ParsePricing(data []byte) (Pricing, error) {
+	var p Pricing
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	for model, price := range p {
+		if price.Prompt < 0 || price.Completion < 0 {
+			return nil, fmt.Errorf("price of %s must not be negative", model)
+		}
+	}
+	return p, nil
+}
+
+// Cost returns the cost of usage with model in USD, and false if the model has no price.
+func (p Pricing) Cost(model ModelID, usage Usage) (float64, bool) {
+	price, ok := p[model]
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6, true
+}
@@ -0,0 +1,22 @@
+package chat
+
+import "testing"
+
+func TestPricing(t *testing.T) {
+	p, err := ParsePricing([]byte(`{"llama3-8b-8192": {"prompt": 0.05, "completion": 0.08}}`))
+	if err != nil {
+		t.Fatalf("ParsePricing returned error: %v", err)
+	}
+
+	cost, ok := p.Cost(ModelIDLLAMA38B, Usage{PromptTokens: 2_000_000, CompletionTokens: 500_000})
+	if !ok || cost != 0.14 {
+		t.Fatalf("expected a cost of 0.14, got %v (%v)", cost, ok)
+	}
+	if _, ok := p.Cost(ModelIDGEMMA, Usage{PromptTokens: 1}); ok {
+		t.Fatal("expected models without a price to have no cost")
+	}
+
+	if _, err := ParsePricing([]byte(`{"gemma-7b-it": {"prompt": -1}}`)); err == nil {
+		t.Fatal("expected negative prices to be rejected")
+	}
+}
@@ -1,7 +1,6 @@
 package chat
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -21,26 +20,21 @@ type ChatStreamResponse struct {
 // SendMessage is an interface for streaming chat responses
 func (c *groqClient) SendMessage(ctx context.Context, req ChatRequest) (<-chan *ChatStreamResponse, func(), error) {
 
-	url := fmt.Sprintf("%s/v1/chat/completions", c.BaseURL)
-
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal request: %v", err)
-	}
-
 	ctxWithCancel, cancel := context.WithCancel(ctx)
-	httpReq, err := http.NewRequestWithContext(ctxWithCancel, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	httpReq, err := c.newRequest(ctxWithCancel, req)
 	if err != nil {
 		cancel()
 
-		return nil, nil, fmt.Errorf("failed to create request: %v", err)
+		return nil, nil, err
 	}
 
-	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
-
 	responseCh := make(chan *ChatStreamResponse)
 
-	conn := sse.NewConnection(httpReq)
+	client := &sse.Client{
+		HTTPClient:        c.HTTPClient,
+		ResponseValidator: validateStreamResponse,
+	}
+	conn := client.NewConnection(httpReq)
 
 	// Set up the connection to handle incoming messages
 	// This will handle the incoming SSE messages and send them to the response channel
@@ -50,7 +44,7 @@ func (c *groqClient) SendMessage(ctx context.Context, req ChatRequest) (<-chan *
 		err := conn.Connect()
 		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, context.Canceled) {
 			responseCh <- &ChatStreamResponse{
-				Error: fmt.Errorf("failed to connect to SSE stream: %v", err),
+				Error: fmt.Errorf("failed to connect to SSE stream: %w", err),
 			}
 		}
 	}()
@@ -70,6 +64,8 @@ func (c *groqClient) SendMessage(ctx context.Context, req ChatRequest) (<-chan *
 			}
 			return
 		}
+		chatResponse.Raw = json.RawMessage(e.Data)
+
 		responseCh <- &ChatStreamResponse{
 			Response: chatResponse,
 			Error:    nil,
@@ -82,3 +78,12 @@ func (c *groqClient) SendMessage(ctx context.Context, req ChatRequest) (<-chan *
 		rm()
 	}, nil
 }
+
+// validateStreamResponse rejects non-2xx responses with an *APIError so callers
+// can tell upstream failures apart from transport errors.
+func validateStreamResponse(res *http.Response) error {
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return newAPIError(res)
+	}
+	return sse.DefaultValidator(res)
+}
@@ -3,6 +3,7 @@ package chat
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -165,3 +166,45 @@ func TestSendMessage_StreamEOF(t *testing.T) {
 		t.Errorf("expected 0 responses, got %d", len(responses))
 	}
 }
+
+func TestSendMessage_StreamAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+	}))
+	defer server.Close()
+
+	client := &groqClient{
+		BaseURL: server.URL,
+		APIKey:  "fake-key",
+	}
+
+	req := ChatRequest{
+		Model:  ModelIDLLAMA370B,
+		Stream: true,
+		Messages: []Message{
+			{Role: MessageRoleUser, Content: "Test"},
+		},
+	}
+
+	stream, cancel, err := client.SendMessage(context.Background(), req)
+	defer cancel()
+	if err != nil {
+		t.Fatalf("SendMessage returned error: %v", err)
+	}
+
+	var apiErr *APIError
+	for msg := range stream {
+		if msg.Error != nil && !errors.As(msg.Error, &apiErr) {
+			t.Errorf("expected *APIError, got: %v", msg.Error)
+		}
+	}
+
+	if apiErr == nil || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 APIError, got %v", apiErr)
+	}
+	if !strings.Contains(string(apiErr.Body), "invalid api key") {
+		t.Errorf("expected upstream body to be kept, got %s", apiErr.Body)
+	}
+}
@@ -1,10 +1,8 @@
 package config
 
 import (
-	"bufio"
 	"fmt"
 	"os"
-	"strings"
 )
 
 const (
@@ -12,36 +10,41 @@ const (
 	PASSWORD_FILE = "PASSWORD_FILE"
 )
 
-func ReadEnv() error {
-	var envFilePath string
-
+// envFilePath returns the env file to read, PASSWORD_FILE or .env by default.
+func envFilePath() string {
 	if passwordFilePath, ok := os.LookupEnv(PASSWORD_FILE); ok {
-		envFilePath = passwordFilePath
-	} else {
-		envFilePath = ".env"
+		return passwordFilePath
 	}
+	return ".env"
+}
 
-	file, err := os.Open(envFilePath)
+// ReadEnv loads the env file, PASSWORD_FILE or .env by default, into the
+// process environment. Variables already set in the environment keep their value.
+func ReadEnv() error {
+	return ReadEnvFile(envFilePath(), false)
+}
+
+// ReadEnvFile loads the env file at path into the process environment. With
+// override the values of the file replace variables that are already set,
+// otherwise only unset (or empty) variables are set.
+func ReadEnvFile(path string, override bool) error {
+	vars, err := readEnvFile(path, override)
 	if err != nil {
-		return fmt.Errorf("failed to open env file %s: %w", envFilePath, err)
+		return err
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" || line[0] == '#' {
-			continue // skip empty lines and comments
-		}
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) == 2 {
-			os.Setenv(parts[0], parts[1])
+	for k, v := range vars {
+		if override || os.Getenv(k) == "" {
+			os.Setenv(k, v)
 		}
 	}
+	return nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading env file: %w", err)
+// readEnvFile parses the env file at path, see parseEnv.
+func readEnvFile(path string, override bool) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open env file %s: %w", path, err)
 	}
-
-	return nil
+	return parseEnv(path, content, override)
 }
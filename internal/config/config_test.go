@@ -74,10 +74,38 @@ ANOTHER=valid
 	defer removeEnvFile(t)
 	clearEnvVars("ANOTHER")
 
-	ReadEnv()
+	err := ReadEnv()
+
+	// a broken file is reported with its line and isn't applied at all
+	if err == nil || err.Error() != ".env:2: expected = after INVALID_LINE_WITHOUT_EQUALS" {
+		t.Errorf("ReadEnv() = %v; want a syntax error on line 2", err)
+	}
+	if got := os.Getenv("ANOTHER"); got != "" {
+		t.Errorf("ANOTHER = %q; want '' for a file with errors", got)
+	}
+}
+
+func TestReadEnv_KeepsEnvironment(t *testing.T) {
+	writeEnvFile(t, "FOO=from-file\nBAR=from-file\n")
+	defer removeEnvFile(t)
+	t.Setenv("FOO", "from-env")
+	t.Setenv("BAR", "")
+
+	if err := ReadEnv(); err != nil {
+		t.Fatalf("ReadEnv() = %v", err)
+	}
+	if got := os.Getenv("FOO"); got != "from-env" {
+		t.Errorf("FOO = %q; want the environment to win", got)
+	}
+	if got := os.Getenv("BAR"); got != "from-file" {
+		t.Errorf("BAR = %q; want empty variables to be set from the file", got)
+	}
 
-	if got := os.Getenv("ANOTHER"); got != "valid" {
-		t.Errorf("ANOTHER = %q; want 'valid'", got)
+	if err := ReadEnvFile(".env", true); err != nil {
+		t.Fatalf("ReadEnvFile() = %v", err)
+	}
+	if got := os.Getenv("FOO"); got != "from-file" {
+		t.Errorf("FOO = %q; want the file to win with override", got)
 	}
 }
 
@@ -0,0 +1,300 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SyntaxError is an invalid line of an env file.
+type SyntaxError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// envParser parses the dotenv format:
+//
+//	# comments, blank lines and an optional `export` prefix are ignored
+//	KEY=value                 # unquoted, trimmed, inline comments after a space
+//	KEY = 'literal $value'    # single quotes: taken as is, may span lines
+//	KEY="line\nbreak ${HOME}" # double quotes: escapes and interpolation, may span lines
+//	KEY=${OTHER:-default}     # $OTHER, ${OTHER} and ${OTHER:-default}
+//
+// References resolve to the variables defined earlier in the file or to the
+// environment, whichever wins according to override.
+type envParser struct {
+	file     string
+	src      []rune
+	pos      int
+	line     int
+	override bool
+	vars     map[string]string
+}
+
+// parseEnv parses an env file's content; name is used in error messages.
+func parseEnv(name string, content []byte, override bool) (map[string]string, error) {
+	p := &envParser{
+		file:     name,
+		src:      []rune(string(content)),
+		line:     1,
+		override: override,
+		vars:     make(map[string]string),
+	}
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return p.vars, nil
+		}
+		if err := p.parseLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *envParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *envParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *envParser) next() rune {
+	r := p.src[p.pos]
+	p.pos++
+	if r == '\n' {
+		p.line++
+	}
+	return r
+}
+
+func (p *envParser) errorf(line int, format string, args ...any) error {
+	return &SyntaxError{File: p.file, Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// skipBlank skips whitespace, blank lines and comment lines.
+func (p *envParser) skipBlank() {
+	for !p.eof() {
+		switch r := p.peek(); {
+		case r == '#':
+			p.skipLine()
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			p.next()
+		default:
+			return
+		}
+	}
+}
+
+func (p *envParser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.next()
+	}
+}
+
+func (p *envParser) skipLine() {
+	for !p.eof() && p.next() != '\n' {
+	}
+}
+
+func isNameRune(r rune, first bool) bool {
+	switch {
+	case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		return true
+	case r >= '0' && r <= '9', r == '.':
+		return !first
+	}
+	return false
+}
+
+func (p *envParser) parseName() string {
+	start := p.pos
+	for !p.eof() && isNameRune(p.peek(), p.pos == start) {
+		p.next()
+	}
+	return string(p.src[start:p.pos])
+}
+
+func (p *envParser) parseLine() error {
+	line := p.line
+	key := p.parseName()
+	if key == "export" && (p.peek() == ' ' || p.peek() == '\t') {
+		p.skipSpaces()
+		key = p.parseName()
+	}
+	if key == "" {
+		return p.errorf(line, "invalid variable name")
+	}
+
+	p.skipSpaces()
+	if p.eof() || p.next() != '=' {
+		return p.errorf(line, "expected = after %s", key)
+	}
+	p.skipSpaces()
+
+	var value string
+	var err error
+	switch p.peek() {
+	case '\'':
+		value, err = p.parseSingleQuoted()
+	case '"':
+		value, err = p.parseDoubleQuoted()
+	default:
+		value, err = p.parseUnquoted()
+	}
+	if err != nil {
+		return err
+	}
+
+	p.vars[key] = value
+	return nil
+}
+
+func (p *envParser) parseSingleQuoted() (string, error) {
+	line := p.line
+	p.next()
+	start := p.pos
+	for !p.eof() {
+		if p.peek() == '\'' {
+			value := string(p.src[start:p.pos])
+			p.next()
+			return value, p.endOfValue()
+		}
+		p.next()
+	}
+	return "", p.errorf(line, "unterminated single quoted value")
+}
+
+func (p *envParser) parseDoubleQuoted() (string, error) {
+	line := p.line
+	p.next()
+	var b strings.Builder
+	for !p.eof() {
+		switch r := p.next(); r {
+		case '"':
+			return b.String(), p.endOfValue()
+		case '\\':
+			if p.eof() {
+				continue
+			}
+			switch e := p.next(); e {
+			case 'n':
+				b.WriteRune('\n')
+			case 'r':
+				b.WriteRune('\r')
+			case 't':
+				b.WriteRune('\t')
+			case '"', '\\', '$':
+				b.WriteRune(e)
+			case '\n':
+				// a backslash at the end of the line joins the lines
+			default:
+				b.WriteRune('\\')
+				b.WriteRune(e)
+			}
+		case '$':
+			s, err := p.parseReference()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(s)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return "", p.errorf(line, "unterminated double quoted value")
+}
+
+func (p *envParser) parseUnquoted() (string, error) {
+	var b strings.Builder
+	for !p.eof() && p.peek() != '\n' {
+		r := p.next()
+		switch {
+		case r == '#' && (b.Len() == 0 || strings.HasSuffix(b.String(), " ") || strings.HasSuffix(b.String(), "\t")):
+			p.skipLine()
+			return strings.TrimSpace(b.String()), nil
+		case r == '$':
+			s, err := p.parseReference()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(s)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// endOfValue checks that only a comment follows a quoted value on its line.
+func (p *envParser) endOfValue() error {
+	line := p.line
+	p.skipSpaces()
+	switch {
+	case p.eof():
+		return nil
+	case p.peek() == '\r' || p.peek() == '\n' || p.peek() == '#':
+		p.skipLine()
+		return nil
+	}
+	return p.errorf(line, "unexpected %q after quoted value", p.peek())
+}
+
+// parseReference expands the variable reference following a $.
+func (p *envParser) parseReference() (string, error) {
+	line := p.line
+	if p.peek() != '{' {
+		name := p.parseName()
+		if name == "" {
+			return "$", nil
+		}
+		return p.lookup(name), nil
+	}
+
+	p.next()
+	name := p.parseName()
+	if name == "" {
+		return "", p.errorf(line, "invalid variable name in ${...}")
+	}
+
+	var def string
+	hasDefault := false
+	if p.pos+1 < len(p.src) && p.src[p.pos] == ':' && p.src[p.pos+1] == '-' {
+		p.next()
+		p.next()
+		start := p.pos
+		for !p.eof() && p.peek() != '}' && p.peek() != '\n' {
+			p.next()
+		}
+		def, hasDefault = string(p.src[start:p.pos]), true
+	}
+	if p.eof() || p.next() != '}' {
+		return "", p.errorf(line, "unterminated ${%s", name)
+	}
+
+	value := p.lookup(name)
+	if value == "" && hasDefault {
+		return def, nil
+	}
+	return value, nil
+}
+
+func (p *envParser) lookup(name string) string {
+	if p.override {
+		if v, ok := p.vars[name]; ok {
+			return v
+		}
+		return os.Getenv(name)
+	}
+	// like in Load, an empty variable counts as unset
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return p.vars[name]
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	t.Setenv("FROM_ENV", "env")
+	t.Setenv("SHADOWED", "env")
+
+	content := `
+# comment
+export EXPORTED=yes
+  SPACED   =   value with spaces   
+INLINE=value # comment
+HASH=a#b
+EMPTY=
+EMPTY_COMMENT= # nothing
+SINGLE='literal $FROM_ENV \n # not a comment'
+DOUBLE="tab\there\nnew line \"quoted\" \$FROM_ENV" # comment
+MULTI="first
+second"
+MULTI_SINGLE='one
+two'
+JOINED="a\
+b"
+REF=${FROM_ENV}-$EXPORTED
+SHADOWED=file
+USES_SHADOWED=$SHADOWED
+DEFAULT=${MISSING:-fallback}
+NO_DEFAULT=${FROM_ENV:-fallback}
+DOLLAR=costs $5
+CRLF=value` + "\r\n" + `LAST=1`
+
+	got, err := parseEnv("test.env", []byte(content), false)
+	if err != nil {
+		t.Fatalf("parseEnv returned error: %v", err)
+	}
+
+	want := map[string]string{
+		"EXPORTED":      "yes",
+		"SPACED":        "value with spaces",
+		"INLINE":        "value",
+		"HASH":          "a#b",
+		"EMPTY":         "",
+		"EMPTY_COMMENT": "",
+		"SINGLE":        `literal $FROM_ENV \n # not a comment`,
+		"DOUBLE":        "tab\there\nnew line \"quoted\" $FROM_ENV",
+		"MULTI":         "first\nsecond",
+		"MULTI_SINGLE":  "one\ntwo",
+		"JOINED":        "ab",
+		"REF":           "env-yes",
+		"SHADOWED":      "file",
+		"USES_SHADOWED": "env", // the environment wins
+		"DEFAULT":       "fallback",
+		"NO_DEFAULT":    "env",
+		"DOLLAR":        "costs $5",
+		"CRLF":          "value",
+		"LAST":          "1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("%s = %q; want %q", k, got[k], v)
+			}
+		}
+		t.Fatalf("parseEnv() = %q", got)
+	}
+
+	// with override references see the file's values first
+	got, err = parseEnv("test.env", []byte("SHADOWED=file\nUSES=$SHADOWED"), true)
+	if err != nil || got["USES"] != "file" {
+		t.Fatalf("expected the file to win with override, got %q, %v", got["USES"], err)
+	}
+}
+
+func TestParseEnv_SyntaxErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		line    int
+		msg     string
+	}{
+		{"A=1\nNOEQUALS\n", 2, "expected = after NOEQUALS"},
+		{"A=1\n\n=value", 3, "invalid variable name"},
+		{"1A=x", 1, "invalid variable name"},
+		{"A=\"open\nB=2\n", 1, "unterminated double quoted value"},
+		{"A='open", 1, "unterminated single quoted value"},
+		{"A=\"x\" trailing", 1, `unexpected 't' after quoted value`},
+		{"A=1\nB=${OPEN", 2, "unterminated ${OPEN"},
+		{"A=${}", 1, "invalid variable name in ${...}"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseEnv("test.env", []byte(tt.content), false)
+		var serr *SyntaxError
+		if !errors.As(err, &serr) {
+			t.Errorf("parseEnv(%q) = %v; want a syntax error", tt.content, err)
+			continue
+		}
+		if serr.Line != tt.line || serr.Msg != tt.msg {
+			t.Errorf("parseEnv(%q) = %v; want line %d: %s", tt.content, err, tt.line, tt.msg)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"stream/pkg/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Change is a setting that differs between two configurations.
+type Change struct {
+	Key      string
+	Old, New string // Formatted values, secrets redacted
+	Restart  bool   // The new value only takes effect after a restart
+}
+
+func (c Change) String() string {
+	s := fmt.Sprintf("%s: %q -> %q", c.Key, c.Old, c.New)
+	if c.Old == c.New {
+		// a secret, don't hint at its value
+		s = c.Key + ": changed"
+	}
+	if c.Restart {
+		s += " (ignored until restart)"
+	}
+	return s
+}
+
+// Diff lists the settings that differ between old and new.
+func Diff(old, new Config) []Change {
+	before, after := fields(&old), fields(&new)
+	var changes []Change
+	for i, f := range before {
+		if reflect.DeepEqual(f.value.Interface(), after[i].value.Interface()) {
+			continue
+		}
+		changes = append(changes, Change{Key: f.env, Old: f.format(), New: after[i].format(), Restart: f.restart})
+	}
+	return changes
+}
+
+// Live is the configuration in effect. Handlers and middleware read it on
+// every request, so a Reload applies without restarting the server.
+type Live struct {
+	logger logger.Logger
+	load   func() (Config, error)
+
+	mu       sync.Mutex // Serializes reloads
+	current  atomic.Pointer[Config]
+	onChange []func(*Config)
+}
+
+// NewLive returns a live configuration starting as cfg and reloaded with load,
+// which may be nil for a configuration that never changes.
+func NewLive(logger logger.Logger, cfg Config, load func() (Config, error)) *Live {
+	l := &Live{logger: logger, load: load}
+	l.current.Store(&cfg)
+	return l
+}
+
+// Get returns the configuration in effect. It must not be modified; read it
+// once per request so a concurrent reload can't mix two versions.
+func (l *Live) Get() *Config {
+	return l.current.Load()
+}
+
+// OnChange registers fn to be called with the new configuration after every
+// reload that changed it, for settings that are applied rather than read.
+func (l *Live) OnChange(fn func(*Config)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onChange = append(l.onChange, fn)
+}
+
+// Reload loads the configuration again and swaps it in, logging what changed.
+// A configuration that fails to load or validate is rejected and the current
+// one is kept. Settings that need a restart keep their current value.
+func (l *Live) Reload() ([]Change, error) {
+	if l.load == nil {
+		return nil, errors.New("configuration can't be reloaded")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cfg, err := l.load()
+	if err != nil {
+		l.logger.Printf("rejecting configuration reload: %v", err)
+		return nil, err
+	}
+
+	old := l.current.Load()
+	changes := Diff(*old, cfg)
+	if len(changes) == 0 {
+		l.logger.Printf("configuration reloaded, nothing changed")
+		return nil, nil
+	}
+
+	before, after := fields(old), fields(&cfg)
+	for i, f := range before {
+		if f.restart {
+			after[i].value.Set(f.value)
+		}
+	}
+	l.current.Store(&cfg)
+
+	for _, c := range changes {
+		l.logger.Printf("configuration reloaded: %s", c)
+	}
+	for _, fn := range l.onChange {
+		fn(&cfg)
+	}
+	return changes, nil
+}
+
+// Watch reloads the configuration whenever the env file it was read from
+// changes, checking every interval, until ctx is done.
+func (l *Live) Watch(ctx context.Context, interval time.Duration) {
+	path := l.Get().EnvFile
+	last := statFile(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if current := statFile(path); current != last {
+			last = current
+			l.Reload()
+		}
+	}
+}
+
+// fileState is what Watch compares to notice that a file changed.
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
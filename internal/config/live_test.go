@@ -0,0 +1,107 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"stream/pkg/logger"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLive(t *testing.T, content string) (*Live, string) {
+	t.Helper()
+	path := isolate(t, content)
+	load := func() (Config, error) { return Load([]string{"-env-file", path}) }
+	cfg, err := load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	return NewLive(logger.NewStdLogger(log.Default()), cfg, load), path
+}
+
+func TestLive_Reload(t *testing.T) {
+	live, path := newTestLive(t, "GROQ_API_KEY=key\nMAX_TOKENS=100\n")
+	first := live.Get()
+	var notified *Config
+	live.OnChange(func(c *Config) { notified = c })
+
+	content := "GROQ_API_KEY=rotated\nMAX_TOKENS=200\nRATE_LIMIT_BURST=20\nSYSTEM_PROMPT=Be brief.\nADDR=:9090\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+
+	changes, err := live.Reload()
+	if err != nil {
+		t.Fatalf("Reload returned error: %v", err)
+	}
+
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		`ADDR: ":8080" -> ":9090" (ignored until restart)`,
+		`GROQ_API_KEY: changed (ignored until restart)`,
+		`MAX_TOKENS: "100" -> "200"`,
+		`SYSTEM_PROMPT: "" -> "Be brief."`,
+		`RATE_LIMIT_BURST: "10" -> "20"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	cfg := live.Get()
+	if cfg.MaxTokens != 200 || cfg.RateLimit.Burst != 20 || cfg.SystemPrompt != "Be brief." {
+		t.Errorf("reloaded settings were not applied: %+v", cfg)
+	}
+	if cfg.Addr != ":8080" || cfg.GroqAPIKey.Reveal() != "key" {
+		t.Errorf("settings that need a restart changed: Addr=%q GroqAPIKey=%q", cfg.Addr, cfg.GroqAPIKey.Reveal())
+	}
+	if notified != cfg {
+		t.Errorf("OnChange was not called with the new configuration")
+	}
+	if first.MaxTokens != 100 {
+		t.Errorf("the previous configuration was modified: MaxTokens=%d", first.MaxTokens)
+	}
+}
+
+func TestLive_RejectsInvalidReload(t *testing.T) {
+	live, path := newTestLive(t, "GROQ_API_KEY=key\nMAX_TOKENS=100\n")
+
+	if err := os.WriteFile(path, []byte("GROQ_API_KEY=key\nMAX_TOKENS=-1\nDEFAULT_MODEL=gpt-2\n"), 0o600); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	if _, err := live.Reload(); err == nil {
+		t.Fatal("expected the invalid configuration to be rejected")
+	} else if msg := err.Error(); !strings.Contains(msg, "MAX_TOKENS") || !strings.Contains(msg, `DEFAULT_MODEL: unknown model "gpt-2"`) {
+		t.Errorf("error %q doesn't name every problem", msg)
+	}
+
+	if got := live.Get().MaxTokens; got != 100 {
+		t.Errorf("MaxTokens = %d; want the previous configuration to stay", got)
+	}
+}
+
+func TestLive_Watch(t *testing.T) {
+	live, path := newTestLive(t, "GROQ_API_KEY=key\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go live.Watch(ctx, 10*time.Millisecond)
+
+	// let the watcher take note of the file before it changes
+	time.Sleep(30 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("GROQ_API_KEY=key\nQUOTA_DAILY_TOKENS=5000\n"), 0o600); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for live.Get().Quota.Daily != 5000 {
+		if time.Now().After(deadline) {
+			t.Fatal("the change of the env file was not picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,253 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Secret is a configuration value that must not show up in logs. It prints as
+// [REDACTED]; use Reveal to get the value.
+type Secret string
+
+func (s Secret) Reveal() string { return string(s) }
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+func (s Secret) GoString() string { return strconv.Quote(s.String()) }
+
+func (s Secret) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// Error lists every problem found while loading the configuration.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// field is a configuration value, with its struct tags.
+type field struct {
+	env      string
+	flag     string
+	def      string
+	usage    string
+	required bool
+	restart  bool // Changes only take effect after a restart
+	value    reflect.Value
+}
+
+// fields returns the configurable fields of cfg, including those of nested structs.
+func fields(cfg *Config) []field {
+	var out []field
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			env := sf.Tag.Get("env")
+			if env == "" {
+				if sf.Type.Kind() == reflect.Struct {
+					walk(v.Field(i))
+				}
+				continue
+			}
+			out = append(out, field{
+				env:      env,
+				flag:     strings.ReplaceAll(strings.ToLower(env), "_", "-"),
+				def:      sf.Tag.Get("default"),
+				usage:    sf.Tag.Get("usage"),
+				required: sf.Tag.Get("required") == "true",
+				restart:  sf.Tag.Get("reload") == "restart",
+				value:    v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem())
+	return out
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// noneValue sets a list to no items.
+const noneValue = "none"
+
+// set parses raw into the field.
+func (f field) set(raw string) error {
+	v := f.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 30s or 5m, got %q", raw)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("must be an integer, got %q", raw)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("must be a number, got %q", raw)
+		}
+		v.SetFloat(n)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("must be true or false, got %q", raw)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		// empty values are unset, none is how a list with a default is emptied
+		if strings.TrimSpace(raw) == noneValue {
+			v.Set(reflect.ValueOf([]string{}))
+			return nil
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %s", v.Type()))
+	}
+	return nil
+}
+
+// format renders the field's value the way it is written in the environment.
+func (f field) format() string {
+	switch v := f.value.Interface().(type) {
+	case []string:
+		if len(v) == 0 && f.def != "" {
+			return noneValue
+		}
+		return strings.Join(v, ",")
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Defaults returns the configuration with every default applied.
+func Defaults() Config {
+	var cfg Config
+	for _, f := range fields(&cfg) {
+		if f.def != "" {
+			if err := f.set(f.def); err != nil {
+				panic(fmt.Sprintf("config: invalid default of %s: %v", f.env, err))
+			}
+		}
+	}
+	return cfg
+}
+
+// Load reads the configuration. Every value is taken from, by precedence:
+// the command line flags in args, the environment, the env file (-env-file,
+// PASSWORD_FILE or .env) and the defaults; -env-override puts the env file
+// before the environment. Empty values count as unset, lists are emptied with
+// none (e.g. CORS_ALLOWED_ORIGINS=none). The returned *Error
+// lists every invalid or missing value at once.
+func Load(args []string) (Config, error) {
+	cfg := Defaults()
+	fs := flagSet(&cfg)
+	envFile := fs.String("env-file", "", "env file to read, defaults to $"+PASSWORD_FILE+" or .env")
+	override := fs.Bool("env-override", false, "let the env file win over the environment")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	path, explicit := *envFile, *envFile != ""
+	if !explicit {
+		path = envFilePath()
+		_, explicit = os.LookupEnv(PASSWORD_FILE)
+	}
+	cfg.EnvFile = path
+	fileVars, err := readEnvFile(path, *override)
+	if err != nil {
+		// only a file that was asked for has to exist
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			return cfg, err
+		}
+	}
+
+	flags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+
+	var problems []string
+	for _, f := range fields(&cfg) {
+		sources := []struct{ raw, name string }{
+			{flags[f.flag], "-" + f.flag},
+			{os.Getenv(f.env), f.env},
+			{fileVars[f.env], f.env + " in " + path},
+		}
+		if *override {
+			sources[1], sources[2] = sources[2], sources[1]
+		}
+		var raw, source string
+		for _, s := range sources {
+			if s.raw != "" {
+				raw, source = s.raw, s.name
+				break
+			}
+		}
+
+		if raw == "" {
+			if f.required {
+				problems = append(problems, fmt.Sprintf("%s: required, set it in the environment, %s or with -%s", f.env, path, f.flag))
+			}
+			continue
+		}
+		if err := f.set(raw); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (from %s): %v", f.env, source, err))
+		}
+	}
+	if len(problems) > 0 {
+		return cfg, &Error{Problems: problems}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// flagSet returns the flags of every field. Their values are only collected
+// here; Load applies them to cfg with the same parsing as the environment.
+func flagSet(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	for _, f := range fields(cfg) {
+		usage := f.usage + " ($" + f.env + ")"
+		fs.String(f.flag, f.def, usage)
+	}
+	return fs
+}
+
+// String lists the configuration as KEY=value pairs, with secrets redacted, for logs.
+func (c Config) String() string {
+	var b strings.Builder
+	for i, f := range fields(&c) {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s=%s", f.env, f.format())
+	}
+	return b.String()
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolate clears every configuration variable for the test and returns an
+// env file path in a temporary directory.
+func isolate(t *testing.T, content string) string {
+	t.Helper()
+	for _, f := range fields(&Config{}) {
+		t.Setenv(f.env, "")
+	}
+	t.Setenv(PASSWORD_FILE, "")
+	os.Unsetenv(PASSWORD_FILE)
+
+	path := filepath.Join(t.TempDir(), "test.env")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := isolate(t, "GROQ_API_KEY=from-file\nMAX_TOKENS=100\nRATE_LIMIT_BURST=3\nCORS_ALLOWED_ORIGINS=https://a.example.com, https://b.example.com\n")
+	t.Setenv("MAX_TOKENS", "200")
+	t.Setenv("RATE_LIMIT_BURST", "4")
+
+	cfg, err := Load([]string{"-env-file", path, "-rate-limit-burst", "5", "-cors-max-age", "1h"})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.GroqAPIKey.Reveal() != "from-file" {
+		t.Errorf("GroqAPIKey = %q; want the value of the env file", cfg.GroqAPIKey.Reveal())
+	}
+	if cfg.MaxTokens != 200 {
+		t.Errorf("MaxTokens = %d; want the environment to win over the file", cfg.MaxTokens)
+	}
+	if cfg.RateLimit.Burst != 5 {
+		t.Errorf("Burst = %d; want the flag to win over the environment", cfg.RateLimit.Burst)
+	}
+	if cfg.CORS.MaxAge != time.Hour {
+		t.Errorf("MaxAge = %v; want 1h", cfg.CORS.MaxAge)
+	}
+	if want := []string{"https://a.example.com", "https://b.example.com"}; !reflect.DeepEqual(cfg.CORS.AllowedOrigins, want) {
+		t.Errorf("AllowedOrigins = %q; want %q", cfg.CORS.AllowedOrigins, want)
+	}
+
+	cfg, err = Load([]string{"-env-file", path, "-env-override"})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.MaxTokens != 100 {
+		t.Errorf("MaxTokens = %d; want the env file to win with -env-override", cfg.MaxTokens)
+	}
+
+	// untouched values keep their defaults
+	if cfg.Addr != ":8080" || cfg.RateLimit.PerMinute != 60 || cfg.Auth.JWTUserClaim != "sub" {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoad_NoneList(t *testing.T) {
+	path := isolate(t, "GROQ_API_KEY=k\nCORS_ALLOWED_ORIGINS=none\nAUDIT_REDACT=\n")
+	t.Setenv("AUDIT_REDACT", " none ")
+
+	cfg, err := Load([]string{"-env-file", path})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.CORS.AllowedOrigins == nil || len(cfg.CORS.AllowedOrigins) != 0 {
+		t.Errorf("AllowedOrigins = %q; want none", cfg.CORS.AllowedOrigins)
+	}
+	if cfg.Audit.Redact == nil || len(cfg.Audit.Redact) != 0 {
+		t.Errorf("Redact = %q; want none", cfg.Audit.Redact)
+	}
+	if out := cfg.String(); !strings.Contains(out, "CORS_ALLOWED_ORIGINS=none") {
+		t.Errorf("expected an emptied list to be listed as none, got %s", out)
+	}
+	// an empty value still takes the default
+	path = isolate(t, "GROQ_API_KEY=k\nCORS_ALLOWED_METHODS=\n")
+	if cfg, err = Load([]string{"-env-file", path}); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if want := []string{"GET", "POST"}; !reflect.DeepEqual(cfg.CORS.AllowedMethods, want) {
+		t.Errorf("AllowedMethods = %q; want the default %q", cfg.CORS.AllowedMethods, want)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	path := isolate(t, "MAX_TOKENS=lots\nRATE_LIMIT_BURST=0\nCORS_MAX_AGE=forever\n")
+
+	_, err := Load([]string{"-env-file", path})
+	var cerr *Error
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected a configuration error, got %v", err)
+	}
+
+	msg := err.Error()
+	for _, want := range []string{
+		"GROQ_API_KEY: required",
+		`MAX_TOKENS (from MAX_TOKENS in ` + path + `): must be an integer, got "lots"`,
+		`CORS_MAX_AGE (from CORS_MAX_AGE in ` + path + `): must be a duration`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected the error to contain %q, got:\n%s", want, msg)
+		}
+	}
+
+	// range checks run once every value parses
+	path = isolate(t, "GROQ_API_KEY=k\nRATE_LIMIT_BURST=0\nCORS_ALLOW_CREDENTIALS=true\nMAX_TOKENS=10000\n")
+	_, err = Load([]string{"-env-file", path})
+	if err == nil || !strings.Contains(err.Error(), "RATE_LIMIT_BURST: must be positive") || !strings.Contains(err.Error(), "CORS_ALLOW_CREDENTIALS") {
+		t.Fatalf("expected range errors, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "MAX_TOKENS: must be at most 8192 for DEFAULT_MODEL llama3-8b-8192") {
+		t.Errorf("expected MAX_TOKENS to be checked against the default model, got %v", err)
+	}
+}
+
+func TestLoad_EnvFile(t *testing.T) {
+	isolate(t, "")
+	t.Setenv("GROQ_API_KEY", "k")
+	t.Chdir(t.TempDir())
+
+	// the default .env may be missing
+	if _, err := Load(nil); err != nil {
+		t.Fatalf("expected a missing .env to be fine, got %v", err)
+	}
+
+	// a file that was asked for must exist
+	if _, err := Load([]string{"-env-file", "missing.env"}); err == nil {
+		t.Fatal("expected an error for a missing -env-file")
+	}
+	t.Setenv(PASSWORD_FILE, "missing.env")
+	if _, err := Load(nil); err == nil {
+		t.Fatal("expected an error for a missing PASSWORD_FILE")
+	}
+}
+
+func TestSecret_Redaction(t *testing.T) {
+	cfg := Defaults()
+	cfg.GroqAPIKey = "gsk_live_secret"
+	cfg.Budget.WebhookURL = "https://hooks.example.com/T0/B0/token"
+
+	out := cfg.String()
+	if strings.Contains(out, "gsk_live_secret") || strings.Contains(out, "token") {
+		t.Fatalf("expected secrets to be redacted, got %s", out)
+	}
+	if !strings.Contains(out, "GROQ_API_KEY=[REDACTED]") || !strings.Contains(out, "MAX_TOKENS=1024") {
+		t.Fatalf("expected every setting to be listed, got %s", out)
+	}
+
+	b, _ := json.Marshal(cfg)
+	if strings.Contains(string(b), "gsk_live_secret") {
+		t.Fatalf("expected secrets to be redacted in JSON, got %s", b)
+	}
+}
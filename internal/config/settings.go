@@ -0,0 +1,209 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"stream/internal/chat"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of the service, see Load. Every field is read
+// from the environment variable named by its env tag, or the matching flag.
+// Fields tagged reload:"restart" keep their value when the configuration is
+// reloaded, see Live.
+type Config struct {
+	Addr            string        `env:"ADDR" default:":8080" reload:"restart" usage:"Address the server listens on, host:port or unix:/path/of.sock"`
+	DrainTimeout    time.Duration `env:"DRAIN_TIMEOUT" default:"30s" usage:"How long streams may go on after a shutdown signal before they are ended with a shutdown event"`
+	ReadinessGrace  time.Duration `env:"READINESS_GRACE" default:"5s" usage:"How long new connections are still accepted, and answered with 503, after a shutdown signal so load balancers see /readyz fail"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"5s" usage:"How long to wait, after DRAIN_TIMEOUT, for requests and conversation writes to finish on shutdown"`
+	GroqAPIKey      Secret        `env:"GROQ_API_KEY" required:"true" reload:"restart" usage:"API key of the Groq API"`
+	MaxTokens       int           `env:"MAX_TOKENS" default:"1024" usage:"Default max_tokens of chat requests"`
+	DefaultModel    string        `env:"DEFAULT_MODEL" default:"llama3-8b-8192" usage:"Model of chat requests that don't name one"`
+	SystemPrompt    string        `env:"SYSTEM_PROMPT" usage:"System message prepended to chat requests that don't have one"`
+	LogLevel        string        `env:"LOG_LEVEL" default:"info" usage:"Least severe messages logged: debug, info, warn or error"`
+	LogFormat       string        `env:"LOG_FORMAT" default:"text" reload:"restart" usage:"Format of log lines: text or json"`
+	ImageStoreMaxMB int           `env:"IMAGE_STORE_MAX_MB" default:"256" reload:"restart" usage:"Memory in MB kept for uploaded images, the least recently used are dropped beyond it; 0 is no limit"`
+	ReloadInterval  time.Duration `env:"CONFIG_RELOAD_INTERVAL" default:"10s" reload:"restart" usage:"How often the env file is checked for changes, 0 only reloads on SIGHUP"`
+
+	// EnvFile is the env file the configuration was read from, it may not exist.
+	EnvFile string
+
+	Server    Server
+	Auth      Auth
+	Admin     Admin
+	RateLimit RateLimit
+	Quota     Quota
+	Budget    Budget
+	CORS      CORS
+	LogSinks  LogSinks
+	Tracing   Tracing
+	Readiness Readiness
+	Audit     Audit
+}
+
+// Server configures the HTTP server.
+type Server struct {
+	ReadHeaderTimeout  time.Duration `env:"SERVER_READ_HEADER_TIMEOUT" default:"10s" reload:"restart" usage:"How long clients may take to send the headers of a request"`
+	IdleTimeout        time.Duration `env:"SERVER_IDLE_TIMEOUT" default:"2m" reload:"restart" usage:"How long idle keep-alive connections are kept open"`
+	MaxHeaderBytes     int           `env:"SERVER_MAX_HEADER_BYTES" default:"1048576" reload:"restart" usage:"Largest request headers accepted, in bytes"`
+	WriteTimeout       time.Duration `env:"SERVER_WRITE_TIMEOUT" default:"30s" usage:"How long handlers other than chat may take to write their response, 0 is no limit"`
+	StreamWriteTimeout time.Duration `env:"SERVER_STREAM_WRITE_TIMEOUT" default:"30s" usage:"How long each write of a chat response may take, the response itself has no limit; 0 is no limit"`
+	TLSCertFile        string        `env:"TLS_CERT_FILE" reload:"restart" usage:"PEM certificate chain to serve HTTPS with, loaded again when it changes"`
+	TLSKeyFile         string        `env:"TLS_KEY_FILE" reload:"restart" usage:"PEM private key of TLS_CERT_FILE"`
+	H2C                bool          `env:"SERVER_H2C" default:"false" reload:"restart" usage:"Accept HTTP/2 without TLS (h2c), for internal clients"`
+}
+
+type Auth struct {
+	APIKeys      Secret `env:"API_KEYS" reload:"restart" usage:"Comma separated owner[:name]:sha256-hex[:budget] API key entries"`
+	JWKSURL      string `env:"JWKS_URL" reload:"restart" usage:"JWKS file path or URL to verify JWT bearer tokens with"`
+	JWTIssuer    string `env:"JWT_ISSUER" reload:"restart" usage:"Required issuer of JWTs"`
+	JWTAudience  string `env:"JWT_AUDIENCE" reload:"restart" usage:"Required audience of JWTs"`
+	JWTUserClaim string `env:"JWT_USER_CLAIM" default:"sub" reload:"restart" usage:"JWT claim holding the user ID"`
+}
+
+// Admin lists who may change the service at runtime.
+type Admin struct {
+	Users []string `env:"ADMIN_USERS" usage:"Comma separated IDs of the users (API key owners or JWT users) allowed to use /admin and the X-Debug-Log header"`
+}
+
+type RateLimit struct {
+	PerMinute int `env:"RATE_LIMIT_PER_MINUTE" default:"60" usage:"Requests per minute allowed per client, 0 disables rate limiting"`
+	Burst     int `env:"RATE_LIMIT_BURST" default:"10" usage:"Requests a client may send at once"`
+
+	// checked before authentication, so floods of bad credentials are
+	// limited too; generous as clients behind a NAT share an address
+	IPPerMinute int `env:"RATE_LIMIT_IP_PER_MINUTE" default:"600" usage:"Requests per minute allowed per IP address before authentication, 0 disables it"`
+	IPBurst     int `env:"RATE_LIMIT_IP_BURST" default:"100" usage:"Requests an IP address may send at once"`
+}
+
+// Quota caps the tokens (prompt and completion) an owner may use per UTC day
+// and calendar month. Zero means unlimited.
+type Quota struct {
+	Daily   int `json:"daily" env:"QUOTA_DAILY_TOKENS" usage:"Tokens each user may use per UTC day, 0 is unlimited"`
+	Monthly int `json:"monthly" env:"QUOTA_MONTHLY_TOKENS" usage:"Tokens each user may use per calendar month, 0 is unlimited"`
+}
+
+type Budget struct {
+	PricingFile string  `env:"PRICING_FILE" reload:"restart" usage:"JSON file with the price of each model in USD per million tokens"`
+	MonthlyUSD  float64 `env:"BUDGET_MONTHLY_USD" usage:"Monthly spend per user in USD that raises an alert, 0 is none"`
+	WebhookURL  Secret  `env:"BUDGET_WEBHOOK_URL" reload:"restart" usage:"URL budget alerts are POSTed to"`
+}
+
+// CORS is the cross-origin policy of the API.
+type CORS struct {
+	// AllowedOrigins lists the origins allowed to call the API. An entry is
+	// an exact origin, "*" for any origin, or a pattern with a single "*"
+	// such as "https://*.example.com".
+	AllowedOrigins   []string      `env:"CORS_ALLOWED_ORIGINS" default:"*" reload:"restart" usage:"Origins allowed to call the API: exact, * or patterns like https://*.example.com"`
+	AllowedMethods   []string      `env:"CORS_ALLOWED_METHODS" default:"GET,POST" reload:"restart" usage:"Methods allowed in cross-origin requests"`
+	AllowedHeaders   []string      `env:"CORS_ALLOWED_HEADERS" default:"Accept,Authorization,Content-Type" reload:"restart" usage:"Request headers allowed in cross-origin requests"`
+	ExposedHeaders   []string      `env:"CORS_EXPOSED_HEADERS" default:"X-Conversation-ID,X-Request-ID,Retry-After,X-RateLimit-Limit,X-RateLimit-Remaining,X-RateLimit-Reset" reload:"restart" usage:"Response headers scripts may read"`
+	AllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS" default:"false" reload:"restart" usage:"Allow cookies and Authorization headers, can't be combined with *"`
+	MaxAge           time.Duration `env:"CORS_MAX_AGE" default:"10m" reload:"restart" usage:"How long browsers may cache preflight responses"`
+}
+
+// LogSinks are where logs are sent besides stderr.
+type LogSinks struct {
+	File           string        `env:"LOG_FILE" reload:"restart" usage:"File logs are also written to as JSON lines"`
+	FileMaxSizeMB  int           `env:"LOG_FILE_MAX_SIZE_MB" default:"100" reload:"restart" usage:"Size in MB at which the log file is rotated, 0 is no limit"`
+	FileRotate     time.Duration `env:"LOG_FILE_ROTATE_INTERVAL" default:"24h" reload:"restart" usage:"Age at which the log file is rotated, 0 is no limit"`
+	FileMaxBackups int           `env:"LOG_FILE_MAX_BACKUPS" default:"7" reload:"restart" usage:"Rotated log files kept, 0 keeps them all"`
+	FileMaxAge     time.Duration `env:"LOG_FILE_MAX_AGE" default:"720h" reload:"restart" usage:"Age at which rotated log files are removed, 0 keeps them"`
+	FileCompress   bool          `env:"LOG_FILE_COMPRESS" default:"true" reload:"restart" usage:"Gzip rotated log files"`
+	ShipURL        Secret        `env:"LOG_SHIP_URL" reload:"restart" usage:"URL logs are POSTed to in batches of JSON lines"`
+	ShipBatchSize  int           `env:"LOG_SHIP_BATCH_SIZE" default:"100" reload:"restart" usage:"Log lines sent per request to LOG_SHIP_URL"`
+	ShipInterval   time.Duration `env:"LOG_SHIP_INTERVAL" default:"5s" reload:"restart" usage:"How often logs are sent to LOG_SHIP_URL"`
+}
+
+// Tracing configures where spans are sent.
+type Tracing struct {
+	Exporter     string `env:"TRACING_EXPORTER" default:"none" reload:"restart" usage:"Where spans are sent: none, stdout or otlp"`
+	OTLPEndpoint string `env:"OTLP_ENDPOINT" default:"http://localhost:4318/v1/traces" reload:"restart" usage:"OTLP/HTTP traces URL of the collector spans are sent to"`
+	ServiceName  string `env:"TRACING_SERVICE_NAME" default:"stream" reload:"restart" usage:"Service name spans are reported under"`
+}
+
+// Readiness configures the checks of GET /readyz.
+type Readiness struct {
+	Timeout       time.Duration `env:"READINESS_TIMEOUT" default:"2s" usage:"How long each readiness check may take"`
+	ProbeUpstream bool          `env:"READINESS_PROBE_UPSTREAM" default:"false" usage:"Check that the Groq API can be reached before reporting ready"`
+	UpstreamTTL   time.Duration `env:"READINESS_UPSTREAM_TTL" default:"30s" usage:"How long the result of the upstream check is reused"`
+}
+
+// Audit configures the trail of /chat and /v1/chat/completions exchanges,
+// kept apart from the logs.
+type Audit struct {
+	File          string   `env:"AUDIT_FILE" reload:"restart" usage:"File /chat and /v1/chat/completions exchanges are appended to as JSON lines, none when empty"`
+	Redact        []string `env:"AUDIT_REDACT" default:"email,phone,api_key" reload:"restart" usage:"Comma separated built-in redaction rules applied to audited content: email, phone and api_key"`
+	RedactPattern string   `env:"AUDIT_REDACT_PATTERN" reload:"restart" usage:"Regular expression of more text to redact from audited content"`
+	HashContent   bool     `env:"AUDIT_HASH_CONTENT" default:"false" reload:"restart" usage:"Audit the SHA-256 of prompts and completions instead of their text"`
+}
+
+// Validate reports values that are well-formed but out of range or contradictory.
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.DrainTimeout >= 0, "DRAIN_TIMEOUT: must not be negative")
+	check(c.ReadinessGrace >= 0, "READINESS_GRACE: must not be negative")
+	check(c.ShutdownTimeout >= 0, "SHUTDOWN_TIMEOUT: must not be negative")
+	check(c.MaxTokens > 0, "MAX_TOKENS: must be positive, got %d", c.MaxTokens)
+	limits, known := chat.ModelID(c.DefaultModel).Limits()
+	check(known, "DEFAULT_MODEL: unknown model %q", c.DefaultModel)
+	check(!known || c.MaxTokens <= limits.MaxCompletionTokens, "MAX_TOKENS: must be at most %d for DEFAULT_MODEL %s, got %d", limits.MaxCompletionTokens, c.DefaultModel, c.MaxTokens)
+	check(oneOf(c.LogLevel, "debug", "info", "warn", "error"), "LOG_LEVEL: must be debug, info, warn or error, got %q", c.LogLevel)
+	check(oneOf(c.LogFormat, "text", "json"), "LOG_FORMAT: must be text or json, got %q", c.LogFormat)
+	check(c.Server.ReadHeaderTimeout >= 0, "SERVER_READ_HEADER_TIMEOUT: must not be negative")
+	check(c.Server.IdleTimeout >= 0, "SERVER_IDLE_TIMEOUT: must not be negative")
+	check(c.Server.MaxHeaderBytes > 0, "SERVER_MAX_HEADER_BYTES: must be positive, got %d", c.Server.MaxHeaderBytes)
+	check(c.Server.WriteTimeout >= 0, "SERVER_WRITE_TIMEOUT: must not be negative")
+	check(c.Server.StreamWriteTimeout >= 0, "SERVER_STREAM_WRITE_TIMEOUT: must not be negative")
+	check((c.Server.TLSCertFile == "") == (c.Server.TLSKeyFile == ""), "TLS_CERT_FILE, TLS_KEY_FILE: must be set together")
+	check(c.ImageStoreMaxMB >= 0, "IMAGE_STORE_MAX_MB: must not be negative, got %d", c.ImageStoreMaxMB)
+	check(c.ReloadInterval >= 0, "CONFIG_RELOAD_INTERVAL: must not be negative")
+	check(c.RateLimit.PerMinute >= 0, "RATE_LIMIT_PER_MINUTE: must not be negative, got %d", c.RateLimit.PerMinute)
+	check(c.RateLimit.Burst > 0, "RATE_LIMIT_BURST: must be positive, got %d", c.RateLimit.Burst)
+	check(c.RateLimit.IPPerMinute >= 0, "RATE_LIMIT_IP_PER_MINUTE: must not be negative, got %d", c.RateLimit.IPPerMinute)
+	check(c.RateLimit.IPBurst > 0, "RATE_LIMIT_IP_BURST: must be positive, got %d", c.RateLimit.IPBurst)
+	check(c.Quota.Daily >= 0, "QUOTA_DAILY_TOKENS: must not be negative, got %d", c.Quota.Daily)
+	check(c.Quota.Monthly >= 0, "QUOTA_MONTHLY_TOKENS: must not be negative, got %d", c.Quota.Monthly)
+	check(c.Budget.MonthlyUSD >= 0, "BUDGET_MONTHLY_USD: must not be negative, got %v", c.Budget.MonthlyUSD)
+	check(c.CORS.MaxAge >= 0, "CORS_MAX_AGE: must not be negative")
+	check(c.LogSinks.FileMaxSizeMB >= 0, "LOG_FILE_MAX_SIZE_MB: must not be negative, got %d", c.LogSinks.FileMaxSizeMB)
+	check(c.LogSinks.FileRotate >= 0, "LOG_FILE_ROTATE_INTERVAL: must not be negative")
+	check(c.LogSinks.FileMaxBackups >= 0, "LOG_FILE_MAX_BACKUPS: must not be negative, got %d", c.LogSinks.FileMaxBackups)
+	check(c.LogSinks.FileMaxAge >= 0, "LOG_FILE_MAX_AGE: must not be negative")
+	check(c.LogSinks.ShipBatchSize > 0, "LOG_SHIP_BATCH_SIZE: must be positive, got %d", c.LogSinks.ShipBatchSize)
+	check(c.LogSinks.ShipInterval > 0, "LOG_SHIP_INTERVAL: must be positive")
+	check(oneOf(c.Tracing.Exporter, "none", "stdout", "otlp"), "TRACING_EXPORTER: must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	check(c.Readiness.Timeout > 0, "READINESS_TIMEOUT: must be positive")
+	check(c.Readiness.UpstreamTTL >= 0, "READINESS_UPSTREAM_TTL: must not be negative")
+	for _, name := range c.Audit.Redact {
+		check(oneOf(name, "email", "phone", "api_key"), "AUDIT_REDACT: unknown rule %q, must be email, phone or api_key", name)
+	}
+	if _, err := regexp.Compile(c.Audit.RedactPattern); err != nil {
+		check(false, "AUDIT_REDACT_PATTERN: %v", err)
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(origin != "*" || !c.CORS.AllowCredentials, "CORS_ALLOW_CREDENTIALS: can't be allowed for any origin, list the allowed origins instead")
+		check(strings.Count(origin, "*") <= 1, "CORS_ALLOWED_ORIGINS: pattern %q has more than one wildcard", origin)
+	}
+
+	if len(problems) > 0 {
+		return &Error{Problems: problems}
+	}
+	return nil
+}
+
+func oneOf(s string, values ...string) bool {
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,303 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRefreshInterval is how long a fetched key set is used before it is fetched again.
+	DefaultRefreshInterval = time.Hour
+	// minRefreshInterval limits refetches triggered by unknown key IDs, so
+	// tokens with made up key IDs can't be used to hammer the JWKS endpoint.
+	minRefreshInterval = time.Minute
+	maxJWKSSize        = 1 << 20
+)
+
+var (
+	ErrKeyNotFound = errors.New("signing key not found")
+	// ErrKeySetUnavailable is returned when a key can't be looked up because
+	// the key set failed to load, which is no fault of the token.
+	ErrKeySetUnavailable = errors.New("key set unavailable")
+)
+
+// JWKS is a JSON Web Key Set loaded from a file or a URL. Keys are cached and
+// refetched periodically, or early when a token names a key ID we don't know
+// yet, which picks up key rotations at the identity provider.
+type JWKS struct {
+	source          string
+	refreshInterval time.Duration
+	httpClient      *http.Client
+	now             func() time.Time
+
+	// OnSkippedKey, when set, is called with the reason of every key of a
+	// fetched set that can't be used.
+	OnSkippedKey func(error)
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	fetchErr    error         // Of the last fetch, nil when it succeeded
+	fetching    chan struct{} // Closed when the fetch in flight is done
+}
+
+// NewJWKS returns a key set read from source, an http(s) URL or a file path.
+func NewJWKS(source string, refreshInterval time.Duration) *JWKS {
+	if refreshInterval <= 0 {
+		refreshInterval = DefaultRefreshInterval
+	}
+	return &JWKS{
+		source:          source,
+		refreshInterval: refreshInterval,
+		httpClient:      &http.Client{Timeout: 10 * time.Second},
+		now:             time.Now,
+	}
+}
+
+// Key returns the public key with the given key ID. An empty kid matches the
+// only key of a single-key set.
+//
+// The key set is fetched by one caller at a time and without holding the
+// lock, so lookups aren't held up by a slow endpoint: a key found in a stale
+// set is returned right away while the set is refreshed, only lookups that
+// need the fetch wait for it.
+func (k *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	k.mu.Lock()
+	now := k.now()
+	stale := k.keys == nil || now.Sub(k.fetchedAt) >= k.refreshInterval
+	key, found := k.lookup(kid)
+
+	var fetching chan struct{}
+	if stale || (!found && now.Sub(k.lastAttempt) >= minRefreshInterval) {
+		fetching = k.startFetch(now)
+	}
+	if found || fetching == nil {
+		err := k.notFound(kid, found)
+		k.mu.Unlock()
+		return key, err
+	}
+	k.mu.Unlock()
+
+	select {
+	case <-fetching:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, found = k.lookup(kid)
+	return key, k.notFound(kid, found)
+}
+
+// startFetch starts fetching the key set unless a fetch is in flight already,
+// and returns a channel closed when it is done. k.mu must be held.
+func (k *JWKS) startFetch(now time.Time) chan struct{} {
+	if k.fetching != nil {
+		return k.fetching
+	}
+	k.lastAttempt = now
+	k.fetching = make(chan struct{})
+	go func() {
+		// not the context of the request starting it, the others may wait for
+		// the fetch; the client timeout bounds it
+		keys, err := k.fetch(context.Background())
+
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		// on a failed refresh keep serving the keys we already have
+		if err == nil {
+			k.keys, k.fetchedAt = keys, now
+		}
+		k.fetchErr = err
+		close(k.fetching)
+		k.fetching = nil
+	}()
+	return k.fetching
+}
+
+// notFound returns the error of a lookup of kid, nil when it was found. A key
+// that may only be missing because the key set failed to load is unavailable
+// rather than not found. k.mu must be held.
+func (k *JWKS) notFound(kid string, found bool) error {
+	switch {
+	case found:
+		return nil
+	case k.fetchErr != nil:
+		return fmt.Errorf("%w: %w", ErrKeySetUnavailable, k.fetchErr)
+	}
+	return fmt.Errorf("%w: kid %q", ErrKeyNotFound, kid)
+}
+
+func (k *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (k *JWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(k.source, "http://") || strings.HasPrefix(k.source, "https://") {
+		data, err = k.fetchURL(ctx)
+	} else {
+		data, err = os.ReadFile(strings.TrimPrefix(k.source, "file://"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWKS from %s: %w", k.source, err)
+	}
+
+	keys, skipped, err := ParseJWKS(data)
+	if k.OnSkippedKey != nil {
+		for _, err := range skipped {
+			k.OnSkippedKey(fmt.Errorf("skipped key of JWKS from %s: %w", k.source, err))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS from %s: %w", k.source, err)
+	}
+	return keys, nil
+}
+
+func (k *JWKS) fetchURL(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := k.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, maxJWKSSize))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS parses the RSA and EC signing keys of a JSON Web Key Set, by key ID.
+// Keys of other types or uses are skipped, keys that can't be used (e.g. too
+// short or on an unsupported curve) too and returned as skipped, so one odd
+// key at the identity provider doesn't lose us the others. It fails only
+// when no usable key is left.
+func ParseJWKS(data []byte) (keys map[string]crypto.PublicKey, skipped []error, err error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, nil, err
+	}
+
+	keys = make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = parseRSAKey(k)
+		case "EC":
+			key, err = parseECKey(k)
+		default:
+			continue
+		}
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("key %q: %w", k.Kid, err))
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, skipped, fmt.Errorf("no usable signing keys, %d skipped", len(skipped))
+	}
+	return keys, skipped, nil
+}
+
+func parseRSAKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid exponent")
+	}
+	if n.BitLen() < 2048 {
+		return nil, errors.New("RSA keys must be at least 2048 bits")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func parseECKey(k jwk) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x coordinate: %w", err)
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y coordinate: %w", err)
+	}
+
+	key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	if _, err := key.ECDH(); err != nil {
+		return nil, errors.New("point is not on the curve")
+	}
+	return key, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
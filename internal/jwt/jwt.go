@@ -0,0 +1,225 @@
+// Package jwt verifies JSON Web Tokens signed by an identity provider whose
+// public keys are published as a JSON Web Key Set.
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("token is expired")
+	ErrNotYetValid      = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrInvalidAudience  = errors.New("invalid audience")
+	ErrMissingClaim     = errors.New("missing claim")
+)
+
+// Config describes which tokens a Verifier accepts.
+type Config struct {
+	Issuer    string        // Required "iss" claim, empty accepts any issuer
+	Audience  string        // Required entry of the "aud" claim, empty accepts any audience
+	UserClaim string        // Claim holding the user ID, defaults to "sub"
+	Leeway    time.Duration // Allowed clock skew for "exp" and "nbf"
+}
+
+// Claims are the verified claims of a token.
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	UserID    string         // Value of the configured user claim
+	Raw       map[string]any // Every claim of the token
+}
+
+// KeySource resolves the public key a token was signed with.
+type KeySource interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+type Verifier struct {
+	keys KeySource
+	cfg  Config
+	now  func() time.Time
+}
+
+func NewVerifier(keys KeySource, cfg Config) *Verifier {
+	if cfg.UserClaim == "" {
+		cfg.UserClaim = "sub"
+	}
+	return &Verifier{
+		keys: keys,
+		cfg:  cfg,
+		now:  time.Now,
+	}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// LooksLikeJWT reports whether token has the three dot separated segments of a
+// compact JWS, to tell tokens apart from opaque API keys.
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Verify checks the signature and the registered claims of token.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrMalformed, err)
+	}
+	hash, ok := algHashes[h.Alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlg, h.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrMalformed, err)
+	}
+
+	key, err := v.keys.Key(ctx, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(h.Alg, hash, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrMalformed, err)
+	}
+	return v.checkClaims(raw)
+}
+
+func (v *Verifier) checkClaims(raw map[string]any) (*Claims, error) {
+	now := v.now()
+	c := &Claims{Raw: raw}
+	c.Subject, _ = raw["sub"].(string)
+	c.Issuer, _ = raw["iss"].(string)
+
+	exp, ok := raw["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: exp", ErrMissingClaim)
+	}
+	c.ExpiresAt = time.Unix(int64(exp), 0)
+	if now.After(c.ExpiresAt.Add(v.cfg.Leeway)) {
+		return nil, ErrExpired
+	}
+	if nbf, ok := raw["nbf"].(float64); ok && now.Add(v.cfg.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, ErrNotYetValid
+	}
+
+	if v.cfg.Issuer != "" && c.Issuer != v.cfg.Issuer {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidIssuer, c.Issuer)
+	}
+
+	switch aud := raw["aud"].(type) {
+	case string:
+		c.Audience = []string{aud}
+	case []any:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				c.Audience = append(c.Audience, s)
+			}
+		}
+	}
+	if v.cfg.Audience != "" && !contains(c.Audience, v.cfg.Audience) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAudience, c.Audience)
+	}
+
+	c.UserID, _ = raw[v.cfg.UserClaim].(string)
+	if c.UserID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrMissingClaim, v.cfg.UserClaim)
+	}
+	return c, nil
+}
+
+var algHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"PS256": crypto.SHA256,
+	"PS384": crypto.SHA384,
+	"PS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+}
+
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, signed string, signature []byte) error {
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		switch alg[:2] {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(k, hash, digest, signature)
+		case "PS":
+			err = rsa.VerifyPSS(k, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		default:
+			return fmt.Errorf("%w: %s with an RSA key", ErrUnsupportedAlg, alg)
+		}
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(signature) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported key type %T", ErrUnsupportedAlg, key)
+	}
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
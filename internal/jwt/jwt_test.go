@@ -0,0 +1,318 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sign builds a compact JWS over claims with the given algorithm and key.
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	signed := b64(h) + "." + b64(c)
+
+	digest := algHashes[alg].New()
+	digest.Write([]byte(signed))
+	sum := digest.Sum(nil)
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, algHashes[alg], sum); err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, sum)
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + b64(sig)
+}
+
+// writeJWKS writes a key set with the public halves of the given keys.
+func writeJWKS(t *testing.T, path string, keys map[string]crypto.Signer) {
+	t.Helper()
+
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range keys {
+		switch k := key.Public().(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32)))})
+		}
+	}
+	data, _ := json.Marshal(set)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write JWKS: %v", err)
+	}
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss": "https://id.example.com",
+		"aud": []string{"stream", "other"},
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.Signer{"rsa-1": rsaKey, "ec-1": ecKey})
+
+	v := NewVerifier(NewJWKS(path, time.Hour), Config{Issuer: "https://id.example.com", Audience: "stream"})
+
+	with := func(changes map[string]any) map[string]any {
+		c := validClaims()
+		for k, val := range changes {
+			if val == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = val
+		}
+		return c
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"rs256", sign(t, "RS256", "rsa-1", rsaKey, validClaims()), nil},
+		{"es256", sign(t, "ES256", "ec-1", ecKey, validClaims()), nil},
+		{"string audience", sign(t, "RS256", "rsa-1", rsaKey, with(map[string]any{"aud": "stream"})), nil},
+		{"wrong key", sign(t, "RS256", "rsa-1", otherKey, validClaims()), ErrInvalidSignature},
+		{"unknown kid", sign(t, "RS256", "rsa-9", rsaKey, validClaims()), ErrKeyNotFound},
+		{"expired", sign(t, "RS256", "rsa-1", rsaKey, with(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})), ErrExpired},
+		{"not yet valid", sign(t, "RS256", "rsa-1", rsaKey, with(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()})), ErrNotYetValid},
+		{"missing exp", sign(t, "RS256", "rsa-1", rsaKey, with(map[string]any{"exp": nil})), ErrMissingClaim},
+		{"wrong issuer", sign(t, "RS256", "rsa-1", rsaKey, with(map[string]any{"iss": "https://evil.example.com"})), ErrInvalidIssuer},
+		{"wrong audience", sign(t, "RS256", "rsa-1", rsaKey, with(map[string]any{"aud": "someone-else"})), ErrInvalidAudience},
+		{"missing subject", sign(t, "RS256", "rsa-1", rsaKey, with(map[string]any{"sub": nil})), ErrMissingClaim},
+		{"alg none", b64([]byte(`{"alg":"none"}`)) + "." + b64([]byte(`{"sub":"x"}`)) + ".", ErrUnsupportedAlg},
+		{"garbage", "not.a.jwt", ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(context.Background(), tt.token)
+			if tt.err == nil {
+				if err != nil {
+					t.Fatalf("expected token to verify, got %v", err)
+				}
+				if claims.UserID != "user-1" {
+					t.Fatalf("expected user-1, got %q", claims.UserID)
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestVerify_UserClaim(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.Signer{"rsa-1": rsaKey})
+
+	v := NewVerifier(NewJWKS(path, time.Hour), Config{UserClaim: "email"})
+
+	claims := validClaims()
+	claims["email"] = "ada@example.com"
+	got, err := v.Verify(context.Background(), sign(t, "RS256", "rsa-1", rsaKey, claims))
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if got.UserID != "ada@example.com" || got.Subject != "user-1" {
+		t.Fatalf("unexpected claims: %+v", got)
+	}
+}
+
+func TestJWKS_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.Signer{"rsa-1": rsaKey})
+
+	now := time.Now()
+	keys := NewJWKS(path, time.Hour)
+	keys.now = func() time.Time { return now }
+
+	if _, err := keys.Key(context.Background(), "rsa-1"); err != nil {
+		t.Fatalf("Key returned error: %v", err)
+	}
+
+	// the provider rotates in a new key
+	writeJWKS(t, path, map[string]crypto.Signer{"rsa-1": rsaKey, "ec-2": ecKey})
+
+	// unknown key IDs only trigger a refetch once per minRefreshInterval
+	now = now.Add(time.Second)
+	if _, err := keys.Key(context.Background(), "ec-2"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected refetches to be rate limited, got %v", err)
+	}
+
+	now = now.Add(minRefreshInterval)
+	if _, err := keys.Key(context.Background(), "ec-2"); err != nil {
+		t.Fatalf("expected the rotated key to be fetched, got %v", err)
+	}
+
+	writeJWKS(t, path, map[string]crypto.Signer{"rsa-1": rsaKey, "ec-2": ecKey, "rsa-3": rsaKey})
+	now = now.Add(time.Second)
+	if _, err := keys.Key(context.Background(), "rsa-3"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected refetches to be rate limited, got %v", err)
+	}
+
+	now = now.Add(minRefreshInterval)
+	if _, err := keys.Key(context.Background(), "rsa-3"); err != nil {
+		t.Fatalf("expected the key to be fetched after the interval, got %v", err)
+	}
+
+	// a broken key set keeps the cached keys in use
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := keys.Key(context.Background(), "rsa-1"); err != nil {
+		t.Fatalf("expected cached keys to be served on a failed refresh, got %v", err)
+	}
+}
+
+func TestJWKS_Unavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	keys := NewJWKS(server.URL, time.Hour)
+	if _, err := keys.Key(context.Background(), "rsa-1"); !errors.Is(err, ErrKeySetUnavailable) {
+		t.Fatalf("got %v; want ErrKeySetUnavailable", err)
+	}
+}
+
+func TestJWKS_SingleFetch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.Signer{"rsa-1": rsaKey, "ec-2": ecKey})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first fetch goes through, the refresh hangs until released
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	keys := NewJWKS(server.URL, time.Hour)
+	keys.now = func() time.Time { return now }
+	if _, err := keys.Key(context.Background(), "rsa-1"); err != nil {
+		t.Fatalf("Key returned error: %v", err)
+	}
+
+	// with the set stale and its refresh hanging, known keys are served
+	now = now.Add(2 * time.Hour)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := keys.Key(context.Background(), "rsa-1"); err != nil {
+				t.Errorf("Key returned error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// a lookup needing the refresh gives up with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := keys.Key(ctx, "rsa-3"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v; want the context's error", err)
+	}
+	close(release)
+
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("got %d fetches; want 2", n)
+	}
+}
+
+func TestJWKS_MixedKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.Signer{"rsa-1": rsaKey})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set map[string][]map[string]string
+	if err := json.Unmarshal(data, &set); err != nil {
+		t.Fatal(err)
+	}
+	set["keys"] = append(set["keys"],
+		map[string]string{"kty": "RSA", "kid": "rsa-short", "n": b64(big.NewInt(1<<40 + 1).Bytes()), "e": "AQAB"},
+		map[string]string{"kty": "EC", "kid": "ec-p521", "crv": "P-521", "x": "AQ", "y": "AQ"},
+	)
+	data, _ = json.Marshal(set)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var skipped []error
+	keys := NewJWKS(path, time.Hour)
+	keys.OnSkippedKey = func(err error) { skipped = append(skipped, err) }
+	if _, err := keys.Key(context.Background(), "rsa-1"); err != nil {
+		t.Fatalf("usable key of a mixed set got %v", err)
+	}
+	if len(skipped) != 2 {
+		t.Errorf("got skipped keys %v; want rsa-short and ec-p521", skipped)
+	}
+	if _, err := keys.Key(context.Background(), "ec-p521"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("skipped key got %v; want ErrKeyNotFound", err)
+	}
+
+	// without any usable key the set fails to load
+	if _, _, err := ParseJWKS([]byte(`{"keys":[{"kty":"EC","kid":"ec-p521","crv":"P-521","x":"AQ","y":"AQ"}]}`)); err == nil {
+		t.Error("ParseJWKS of a set without usable keys succeeded")
+	}
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// Metrics are the metrics of the service. The methods of a nil *Metrics do
+// nothing, so instrumented code doesn't need to check whether they are on.
+type Metrics struct {
+	Registry *Registry
+
+	Requests         *Counter   // route, method, status
+	RequestDuration  *Histogram // route, method
+	ActiveStreams    *Gauge
+	TimeToFirstToken *Histogram // model
+	TokensPerSecond  *Histogram // model
+	UpstreamErrors   *Counter   // type
+	Retries          *Counter   // reason
+	StoreDuration    *Histogram // store, operation
+}
+
+// New returns the service metrics, registered on a new Registry.
+func New() *Metrics {
+	r := NewRegistry()
+	return &Metrics{
+		Registry: r,
+		Requests: r.NewCounter("http_requests_total",
+			"HTTP requests served, by route pattern, method and status code.", "route", "method", "status"),
+		RequestDuration: r.NewHistogram("http_request_duration_seconds",
+			"Time to serve HTTP requests, streams included, by route pattern and method.",
+			[]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}, "route", "method"),
+		ActiveStreams: r.NewGauge("chat_active_streams",
+			"Completions being streamed to clients."),
+		TimeToFirstToken: r.NewHistogram("chat_time_to_first_token_seconds",
+			"Time from sending a streamed request upstream to its first content, by model.",
+			[]float64{.05, .1, .25, .5, 1, 2, 5, 10}, "model"),
+		TokensPerSecond: r.NewHistogram("chat_completion_tokens_per_second",
+			"Completion tokens generated per second, by model.",
+			[]float64{10, 25, 50, 100, 250, 500, 1000, 2000}, "model"),
+		UpstreamErrors: r.NewCounter("chat_upstream_errors_total",
+			"Failed requests to the model provider, by type.", "type"),
+		Retries: r.NewCounter("chat_retries_total",
+			"Completions generated again, by reason.", "reason"),
+		StoreDuration: r.NewHistogram("store_operation_duration_seconds",
+			"Time taken by store operations, by store and operation.",
+			[]float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1}, "store", "operation"),
+	}
+}
+
+// ObserveRequest records a served HTTP request. Requests that matched no
+// route share the "unmatched" route, to keep the number of series bounded.
+func (m *Metrics) ObserveRequest(route, method string, status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	if route == "" {
+		route = "unmatched"
+	}
+	m.Requests.Inc(route, method, strconv.Itoa(status))
+	m.RequestDuration.Observe(d.Seconds(), route, method)
+}
+
+// StreamStarted counts a stream as active until StreamEnded.
+func (m *Metrics) StreamStarted() {
+	if m != nil {
+		m.ActiveStreams.Inc()
+	}
+}
+
+func (m *Metrics) StreamEnded() {
+	if m != nil {
+		m.ActiveStreams.Dec()
+	}
+}
+
+// ObserveFirstToken records the time a streamed completion took to start.
+func (m *Metrics) ObserveFirstToken(model string, d time.Duration) {
+	if m != nil {
+		m.TimeToFirstToken.Observe(d.Seconds(), model)
+	}
+}
+
+// ObserveTokenRate records the generation speed of a completion of tokens
+// that took d. Completions without tokens or duration are left out.
+func (m *Metrics) ObserveTokenRate(model string, tokens int, d time.Duration) {
+	if m == nil || tokens <= 0 || d <= 0 {
+		return
+	}
+	m.TokensPerSecond.Observe(float64(tokens)/d.Seconds(), model)
+}
+
+// UpstreamError counts a failed request to the model provider.
+func (m *Metrics) UpstreamError(kind string) {
+	if m != nil {
+		m.UpstreamErrors.Inc(kind)
+	}
+}
+
+// Retry counts a completion generated again.
+func (m *Metrics) Retry(reason string) {
+	if m != nil {
+		m.Retries.Inc(reason)
+	}
+}
+
+// ObserveStoreOp records the duration of a store operation.
+func (m *Metrics) ObserveStoreOp(store, operation string, d time.Duration) {
+	if m != nil {
+		m.StoreDuration.Observe(d.Seconds(), store, operation)
+	}
+}
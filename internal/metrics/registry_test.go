@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests served.", "route", "status")
+	streams := r.NewGauge("active_streams", "Open streams.")
+	latency := r.NewHistogram("latency_seconds", "Latency.\nIn seconds.", []float64{0.1, 1}, "route")
+
+	requests.Inc("POST /chat", "200")
+	requests.Add(2, "POST /chat", "200")
+	requests.Inc(`GET "quoted"`, "404")
+	streams.Inc()
+	streams.Inc()
+	streams.Dec()
+	latency.Observe(0.05, "POST /chat")
+	latency.Observe(0.5, "POST /chat")
+	latency.Observe(3, "POST /chat")
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo returned error: %v", err)
+	}
+
+	want := `# HELP active_streams Open streams.
+# TYPE active_streams gauge
+active_streams 1
+# HELP latency_seconds Latency.\nIn seconds.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="POST /chat",le="0.1"} 1
+latency_seconds_bucket{route="POST /chat",le="1"} 2
+latency_seconds_bucket{route="POST /chat",le="+Inf"} 3
+latency_seconds_sum{route="POST /chat"} 3.55
+latency_seconds_count{route="POST /chat"} 3
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="GET \"quoted\"",status="404"} 1
+requests_total{route="POST /chat",status="200"} 3
+`
+	if b.String() != want {
+		t.Fatalf("unexpected exposition:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *Metrics
+	// none of these may panic
+	m.ObserveRequest("", "GET", 200, time.Second)
+	m.StreamStarted()
+	m.StreamEnded()
+	m.UpstreamError("timeout")
+}
+
+func TestMetrics_ObserveRequest(t *testing.T) {
+	m := New()
+	m.ObserveRequest("", "GET", 404, time.Millisecond)
+	m.ObserveRequest("POST /chat", "POST", 200, 2*time.Second)
+
+	if got := m.Requests.Value("unmatched", "GET", "404"); got != 1 {
+		t.Errorf("unmatched requests = %v; want 1", got)
+	}
+	if got := m.RequestDuration.Sum("POST /chat", "POST"); got != 2 {
+		t.Errorf("duration sum = %v; want 2", got)
+	}
+}
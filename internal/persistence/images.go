@@ -0,0 +1,77 @@
+package persistence
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+type imageKey struct {
+	owner string
+	ref   string
+}
+
+type storedImage struct {
+	key       imageKey
+	data      []byte
+	mediaType string
+}
+
+// memoryImageStore keeps at most maxBytes of images, evicting the least
+// recently used ones first.
+type memoryImageStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	images   map[imageKey]*list.Element // of *storedImage
+	lru      *list.List                 // Most recently used first
+}
+
+// NewInMemoryImageStore returns a store keeping at most maxBytes of images;
+// references to evicted images are not found anymore. Zero is no limit.
+func NewInMemoryImageStore(maxBytes int64) ImageStore {
+	return &memoryImageStore{
+		maxBytes: maxBytes,
+		images:   make(map[imageKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// PutImage stores the image under its content hash, so uploading the same
+// image twice only keeps one copy per owner.
+func (m *memoryImageStore) PutImage(owner string, data []byte, mediaType string) (string, error) {
+	sum := sha256.Sum256(data)
+	ref := "sha256-" + hex.EncodeToString(sum[:])
+	key := imageKey{owner: owner, ref: ref}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.images[key]; ok {
+		m.lru.MoveToFront(e)
+		return ref, nil
+	}
+	m.images[key] = m.lru.PushFront(&storedImage{key: key, data: data, mediaType: mediaType})
+	m.size += int64(len(data))
+
+	for m.maxBytes > 0 && m.size > m.maxBytes && m.lru.Len() > 1 {
+		img := m.lru.Remove(m.lru.Back()).(*storedImage)
+		delete(m.images, img.key)
+		m.size -= int64(len(img.data))
+	}
+	return ref, nil
+}
+
+func (m *memoryImageStore) GetImage(owner, ref string) ([]byte, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.images[imageKey{owner: owner, ref: ref}]
+	if !ok {
+		return nil, "", ErrImageNotFound
+	}
+	m.lru.MoveToFront(e)
+	img := e.Value.(*storedImage)
+	return img.data, img.mediaType, nil
+}
@@ -0,0 +1,41 @@
+package persistence
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestImageStore_Eviction(t *testing.T) {
+	s := NewInMemoryImageStore(10)
+	first, _ := s.PutImage("alice", []byte("aaaa"), "image/png")
+	second, _ := s.PutImage("alice", []byte("bbbb"), "image/png")
+
+	// reading the first image makes the second the least recently used
+	if _, _, err := s.GetImage("alice", first); err != nil {
+		t.Fatal(err)
+	}
+	third, _ := s.PutImage("alice", []byte("cccc"), "image/png")
+
+	if _, _, err := s.GetImage("alice", second); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("least recently used image got %v; want ErrImageNotFound", err)
+	}
+	for _, ref := range []string{first, third} {
+		if _, _, err := s.GetImage("alice", ref); err != nil {
+			t.Errorf("image %s: %v", ref, err)
+		}
+	}
+}
+
+func TestImageStore_Owner(t *testing.T) {
+	s := NewInMemoryImageStore(0)
+	ref, _ := s.PutImage("alice", []byte("image"), "image/png")
+
+	if _, _, err := s.GetImage("bob", ref); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("image of alice read by bob got %v; want ErrImageNotFound", err)
+	}
+	data, mediaType, err := s.GetImage("alice", ref)
+	if err != nil || mediaType != "image/png" || !bytes.Equal(data, []byte("image")) {
+		t.Errorf("got %q %s %v; want the image", data, mediaType, err)
+	}
+}
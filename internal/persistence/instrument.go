@@ -0,0 +1,99 @@
+package persistence
+
+import (
+	"context"
+	"time"
+)
+
+// ObserveFunc receives the duration of an operation of an instrumented store.
+type ObserveFunc func(store, operation string, d time.Duration)
+
+// InstrumentConversationStore returns s reporting the duration of every
+// operation to observe.
+func InstrumentConversationStore(s ConversationStore, observe ObserveFunc) ConversationStore {
+	return &instrumentedConversations{s, observe}
+}
+
+type instrumentedConversations struct {
+	next    ConversationStore
+	observe ObserveFunc
+}
+
+func (s *instrumentedConversations) AppendMessage(owner, convoID string, msg Message) error {
+	defer s.since("append_message", time.Now())
+	return s.next.AppendMessage(owner, convoID, msg)
+}
+
+func (s *instrumentedConversations) GetRecentMessages(owner, convoID string, limit int) ([]Message, error) {
+	defer s.since("get_recent_messages", time.Now())
+	return s.next.GetRecentMessages(owner, convoID, limit)
+}
+
+func (s *instrumentedConversations) SelectAlternate(owner, convoID string, index int) (Message, error) {
+	defer s.since("select_alternate", time.Now())
+	return s.next.SelectAlternate(owner, convoID, index)
+}
+
+// Ping pings the wrapped store, so instrumenting it doesn't hide its Pinger.
+func (s *instrumentedConversations) Ping(ctx context.Context) error {
+	return Ping(ctx, s.next)
+}
+
+func (s *instrumentedConversations) since(op string, start time.Time) {
+	s.observe("conversations", op, time.Since(start))
+}
+
+// InstrumentImageStore returns s reporting the duration of every operation
+// to observe.
+func InstrumentImageStore(s ImageStore, observe ObserveFunc) ImageStore {
+	return &instrumentedImages{s, observe}
+}
+
+type instrumentedImages struct {
+	next    ImageStore
+	observe ObserveFunc
+}
+
+func (s *instrumentedImages) PutImage(owner string, data []byte, mediaType string) (string, error) {
+	defer s.since("put_image", time.Now())
+	return s.next.PutImage(owner, data, mediaType)
+}
+
+func (s *instrumentedImages) GetImage(owner, ref string) ([]byte, string, error) {
+	defer s.since("get_image", time.Now())
+	return s.next.GetImage(owner, ref)
+}
+
+func (s *instrumentedImages) since(op string, start time.Time) {
+	s.observe("images", op, time.Since(start))
+}
+
+// InstrumentUsageStore returns s reporting the duration of every operation
+// to observe.
+func InstrumentUsageStore(s UsageStore, observe ObserveFunc) UsageStore {
+	return &instrumentedUsage{s, observe}
+}
+
+type instrumentedUsage struct {
+	next    UsageStore
+	observe ObserveFunc
+}
+
+func (s *instrumentedUsage) AddUsage(at time.Time, u Usage) error {
+	defer s.since("add_usage", time.Now())
+	return s.next.AddUsage(at, u)
+}
+
+func (s *instrumentedUsage) GetUsage(owner string, from, to time.Time) ([]Usage, error) {
+	defer s.since("get_usage", time.Now())
+	return s.next.GetUsage(owner, from, to)
+}
+
+func (s *instrumentedUsage) GetKeyUsage(owner, key string, from, to time.Time) ([]Usage, error) {
+	defer s.since("get_key_usage", time.Now())
+	return s.next.GetKeyUsage(owner, key, from, to)
+}
+
+func (s *instrumentedUsage) since(op string, start time.Time) {
+	s.observe("usage", op, time.Since(start))
+}
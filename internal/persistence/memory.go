@@ -5,41 +5,102 @@ import (
 	"time"
 )
 
+type conversationKey struct {
+	owner   string
+	convoID string
+}
+
 type memoryStore struct {
 	mu            sync.RWMutex
-	conversations map[string][]Message
+	conversations map[conversationKey][]Message
 }
 
 func NewInMemoryStore() ConversationStore {
 	return &memoryStore{
-		conversations: make(map[string][]Message),
+		conversations: make(map[conversationKey][]Message),
 	}
 }
 
 const maxMessages = 20
 
-func (m *memoryStore) AppendMessage(convoID string, msg Message) error {
+func (m *memoryStore) AppendMessage(owner, convoID string, msg Message) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	key := conversationKey{owner: owner, convoID: convoID}
 	msg.Timestamp = time.Now().Unix()
-	m.conversations[convoID] = append(m.conversations[convoID], msg)
+	m.conversations[key] = append(m.conversations[key], msg)
 
 	// Trim to last 20
-	if len(m.conversations[convoID]) > maxMessages {
-		m.conversations[convoID] = m.conversations[convoID][len(m.conversations[convoID])-maxMessages:]
+	if len(m.conversations[key]) > maxMessages {
+		m.conversations[key] = m.conversations[key][len(m.conversations[key])-maxMessages:]
 	}
 
 	return nil
 }
 
-func (m *memoryStore) GetRecentMessages(convoID string, limit int) ([]Message, error) {
+func (m *memoryStore) GetRecentMessages(owner, convoID string, limit int) ([]Message, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	messages := m.conversations[convoID]
+	messages := m.conversations[conversationKey{owner: owner, convoID: convoID}]
 	if len(messages) > limit {
-		return messages[len(messages)-limit:], nil
+		messages = messages[len(messages)-limit:]
+	}
+	// hand out a copy, messages can change under the lock after we return
+	return append([]Message(nil), messages...), nil
+}
+
+func (m *memoryStore) SelectAlternate(owner, convoID string, index int) (Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages, ok := m.conversations[conversationKey{owner: owner, convoID: convoID}]
+	if !ok {
+		return Message{}, ErrConversationNotFound
+	}
+
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := &messages[i]
+		if len(msg.Alternates) == 0 {
+			continue
+		}
+		if index < 0 || index >= len(msg.Alternates) {
+			return Message{}, ErrNoAlternate
+		}
+		msg.Content = msg.Alternates[index]
+		msg.Selected = index
+		return *msg, nil
+	}
+	return Message{}, ErrNoAlternate
+}
+
+type memoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]APIKey
+}
+
+func NewInMemoryAPIKeyStore() APIKeyStore {
+	return &memoryAPIKeyStore{
+		keys: make(map[string]APIKey),
+	}
+}
+
+func (m *memoryAPIKeyStore) PutAPIKey(key APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys[key.Hash] = key
+	return nil
+}
+
+func (m *memoryAPIKeyStore) GetAPIKey(hash string) (APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok := m.keys[hash]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
 	}
-	return messages, nil
+	return key, nil
 }
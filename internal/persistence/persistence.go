@@ -1,18 +1,116 @@
 package persistence
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
 type StorageType string
 
 type Message struct {
 	Role      string `json:"role"`      // Role of the message sender (e.g., "user" or "assistant")
 	Content   string `json:"content"`   // Content of the Message
 	Timestamp int64  `json:"timestamp"` // Timestamp of the message
+
+	Parts []ContentPart `json:"parts,omitempty"` // Multimodal content; images are kept by reference
+
+	// Alternates holds every generated choice, by index, when several were
+	// requested. Content is the selected one, the first choice by default.
+	Alternates []string `json:"alternates,omitempty"`
+	Selected   int      `json:"selected,omitempty"`
+}
+
+// ContentPart is a stored piece of multimodal message content. Uploaded images
+// live in an ImageStore and are referenced by ImageRef, remote images by URL.
+type ContentPart struct {
+	Type     string `json:"type"`                // "text" or "image_url"
+	Text     string `json:"text,omitempty"`      // Text of a text part
+	ImageURL string `json:"image_url,omitempty"` // Remote image URL
+	ImageRef string `json:"image_ref,omitempty"` // Reference of an image kept in an ImageStore
 }
 
+// ConversationStore keeps conversations per owner; an owner can't see or
+// change the conversations of another owner, even with the same ID.
 type ConversationStore interface {
-	AppendMessage(convoID string, msg Message) error
-	GetRecentMessages(convoID string, limit int) ([]Message, error)
+	AppendMessage(owner, convoID string, msg Message) error
+	GetRecentMessages(owner, convoID string, limit int) ([]Message, error)
+	// SelectAlternate makes the alternate at index the content of the latest
+	// assistant message that has alternates, and returns the updated message.
+	SelectAlternate(owner, convoID string, index int) (Message, error)
+}
+
+// APIKey is an API key as kept at rest: only the SHA-256 hash of the key is stored.
+type APIKey struct {
+	Hash  string `json:"hash"`  // Hex encoded SHA-256 of the key
+	Owner string `json:"owner"` // Identity of the key's holder, owns the conversations
+	Name  string `json:"name"`  // Human readable label
+
+	Budget float64 `json:"budget,omitempty"` // Monthly spend in USD that triggers an alert, 0 for the default
+}
+
+type APIKeyStore interface {
+	PutAPIKey(key APIKey) error
+	// GetAPIKey returns the key with the given hash, or ErrAPIKeyNotFound.
+	GetAPIKey(hash string) (APIKey, error)
+}
+
+// Usage is the token consumption of an owner with one model on one day (UTC).
+type Usage struct {
+	Owner            string  `json:"-"`
+	Key              string  `json:"-"` // Credential of the requests, only used by AddUsage
+	Model            string  `json:"model"`
+	Day              string  `json:"day"` // YYYY-MM-DD
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"` // In USD, for models with a known price
+}
+
+// DayLayout is the format of Usage.Day.
+const DayLayout = "2006-01-02"
+
+type UsageStore interface {
+	// AddUsage adds the counts of u to the usage of u.Owner and u.Model on
+	// the day of at; u.Day is ignored.
+	AddUsage(at time.Time, u Usage) error
+	// GetUsage returns the usage of owner on the days from from to to,
+	// inclusive, ordered by day and model.
+	GetUsage(owner string, from, to time.Time) ([]Usage, error)
+	// GetKeyUsage is GetUsage counting only the requests made with key.
+	GetKeyUsage(owner, key string, from, to time.Time) ([]Usage, error)
+}
+
+// ImageStore keeps uploaded images out of the conversation history; messages
+// only hold the reference returned by PutImage. Like conversations, images
+// belong to an owner and can't be read by another.
+type ImageStore interface {
+	PutImage(owner string, data []byte, mediaType string) (ref string, err error)
+	GetImage(owner, ref string) (data []byte, mediaType string, err error)
+}
+
+// Pinger is implemented by stores backed by a server, to check that it can be
+// reached.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that store can be reached. Stores that don't implement Pinger,
+// such as the in-memory ones, always can.
+func Ping(ctx context.Context, store any) error {
+	if p, ok := store.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
 }
 
+var (
+	ErrImageNotFound        = errors.New("image not found")
+	ErrConversationNotFound = errors.New("conversation not found")
+	ErrNoAlternate          = errors.New("no such alternate")
+	ErrAPIKeyNotFound       = errors.New("api key not found")
+)
+
 const (
 	MemoryStorage StorageType = "memory"
 )
@@ -25,3 +123,32 @@ func NewPersistence(t StorageType) ConversationStore {
 		panic("unsupported persistence type")
 	}
 }
+
+// NewImageStore returns a store keeping at most maxBytes of images, or any
+// amount with zero.
+func NewImageStore(t StorageType, maxBytes int64) ImageStore {
+	switch t {
+	case MemoryStorage:
+		return NewInMemoryImageStore(maxBytes)
+	default:
+		panic("unsupported persistence type")
+	}
+}
+
+func NewAPIKeyStore(t StorageType) APIKeyStore {
+	switch t {
+	case MemoryStorage:
+		return NewInMemoryAPIKeyStore()
+	default:
+		panic("unsupported persistence type")
+	}
+}
+
+func NewUsageStore(t StorageType) UsageStore {
+	switch t {
+	case MemoryStorage:
+		return NewInMemoryUsageStore()
+	default:
+		panic("unsupported persistence type")
+	}
+}
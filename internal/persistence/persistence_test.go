@@ -0,0 +1,84 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestConversationStore_Owner(t *testing.T) {
+	s := NewInMemoryStore()
+	s.AppendMessage("alice", "c1", Message{Role: "user", Content: "Hi"})
+	s.AppendMessage("alice", "c1", Message{Role: "assistant", Content: "A", Alternates: []string{"A", "B"}})
+	s.AppendMessage("bob", "c1", Message{Role: "user", Content: "Hello"})
+
+	messages, _ := s.GetRecentMessages("bob", "c1", 10)
+	if len(messages) != 1 || messages[0].Content != "Hello" {
+		t.Errorf("bob got messages %+v; want only his own", messages)
+	}
+	if messages, _ := s.GetRecentMessages("carol", "c1", 10); len(messages) != 0 {
+		t.Errorf("carol got messages %+v; want none", messages)
+	}
+
+	if _, err := s.SelectAlternate("carol", "c1", 1); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("carol selecting an alternate of alice got %v; want ErrConversationNotFound", err)
+	}
+	if _, err := s.SelectAlternate("bob", "c1", 1); !errors.Is(err, ErrNoAlternate) {
+		t.Errorf("bob selecting an alternate got %v; want ErrNoAlternate", err)
+	}
+	msg, err := s.SelectAlternate("alice", "c1", 1)
+	if err != nil || msg.Content != "B" || msg.Selected != 1 {
+		t.Errorf("got %+v, %v; want alternate B selected", msg, err)
+	}
+	if _, err := s.SelectAlternate("alice", "c1", 2); !errors.Is(err, ErrNoAlternate) {
+		t.Errorf("out of range alternate got %v; want ErrNoAlternate", err)
+	}
+}
+
+func TestConversationStore_Trim(t *testing.T) {
+	s := NewInMemoryStore()
+	for i := range maxMessages + 5 {
+		s.AppendMessage("alice", "c1", Message{Role: "user", Content: fmt.Sprint(i)})
+	}
+
+	messages, _ := s.GetRecentMessages("alice", "c1", 100)
+	if len(messages) != maxMessages || messages[0].Content != "5" {
+		t.Fatalf("got %d messages from %q; want %d from 5", len(messages), messages[0].Content, maxMessages)
+	}
+	messages, _ = s.GetRecentMessages("alice", "c1", 3)
+	if len(messages) != 3 || messages[2].Content != fmt.Sprint(maxMessages+4) {
+		t.Errorf("got %+v; want the 3 latest messages", messages)
+	}
+}
+
+func TestUsageStore_Range(t *testing.T) {
+	s := NewInMemoryUsageStore()
+	day := func(d int, hour int) time.Time { return time.Date(2024, time.March, d, hour, 0, 0, 0, time.UTC) }
+	s.AddUsage(day(1, 0), Usage{Owner: "alice", Model: "m", Requests: 1})
+	s.AddUsage(day(2, 23), Usage{Owner: "alice", Model: "m", Requests: 1})
+	s.AddUsage(day(2, 12), Usage{Owner: "alice", Model: "a", Requests: 1})
+	s.AddUsage(day(3, 0), Usage{Owner: "alice", Model: "m", Requests: 1})
+	s.AddUsage(day(4, 0), Usage{Owner: "alice", Model: "m", Requests: 1})
+	s.AddUsage(day(2, 12), Usage{Owner: "bob", Model: "m", Requests: 1})
+	// late on the 1st in New York is the 2nd in UTC
+	s.AddUsage(time.Date(2024, time.March, 1, 22, 0, 0, 0, time.FixedZone("EST", -5*3600)), Usage{Owner: "alice", Model: "m", Requests: 1})
+
+	// the days of from and to are included whatever the time of day
+	usage, err := s.GetUsage("alice", day(2, 18), day(3, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Usage{
+		{Owner: "alice", Model: "a", Day: "2024-03-02", Requests: 1},
+		{Owner: "alice", Model: "m", Day: "2024-03-02", Requests: 2},
+		{Owner: "alice", Model: "m", Day: "2024-03-03", Requests: 1},
+	}
+	if fmt.Sprint(usage) != fmt.Sprint(want) {
+		t.Errorf("got %+v; want %+v", usage, want)
+	}
+
+	if usage, _ := s.GetUsage("carol", day(1, 0), day(4, 0)); len(usage) != 0 {
+		t.Errorf("carol got usage %+v; want none", usage)
+	}
+}
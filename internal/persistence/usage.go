@@ -0,0 +1,88 @@
+package persistence
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type usageKey struct {
+	owner string
+	key   string
+	model string
+	day   string
+}
+
+type memoryUsageStore struct {
+	mu    sync.RWMutex
+	usage map[usageKey]*Usage
+}
+
+func NewInMemoryUsageStore() UsageStore {
+	return &memoryUsageStore{
+		usage: make(map[usageKey]*Usage),
+	}
+}
+
+func (m *memoryUsageStore) AddUsage(at time.Time, u Usage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := usageKey{owner: u.Owner, key: u.Key, model: u.Model, day: at.UTC().Format(DayLayout)}
+	total, ok := m.usage[key]
+	if !ok {
+		total = &Usage{Owner: u.Owner, Key: u.Key, Model: u.Model, Day: key.day}
+		m.usage[key] = total
+	}
+	total.add(u)
+	return nil
+}
+
+func (m *memoryUsageStore) GetUsage(owner string, from, to time.Time) ([]Usage, error) {
+	return m.get(owner, from, to, func(usageKey) bool { return true })
+}
+
+func (m *memoryUsageStore) GetKeyUsage(owner, key string, from, to time.Time) ([]Usage, error) {
+	return m.get(owner, from, to, func(k usageKey) bool { return k.key == key })
+}
+
+func (u *Usage) add(o Usage) {
+	u.Requests += o.Requests
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.Cost += o.Cost
+}
+
+// get sums the usage of owner per day and model over the keys matching match.
+func (m *memoryUsageStore) get(owner string, from, to time.Time, match func(usageKey) bool) ([]Usage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type dayModel struct{ day, model string }
+	first, last := from.UTC().Format(DayLayout), to.UTC().Format(DayLayout)
+	totals := make(map[dayModel]*Usage)
+	for key, u := range m.usage {
+		// days sort lexically in the YYYY-MM-DD layout
+		if key.owner != owner || key.day < first || key.day > last || !match(key) {
+			continue
+		}
+		total, ok := totals[dayModel{key.day, key.model}]
+		if !ok {
+			total = &Usage{Owner: owner, Model: key.model, Day: key.day}
+			totals[dayModel{key.day, key.model}] = total
+		}
+		total.add(*u)
+	}
+
+	var usage []Usage
+	for _, u := range totals {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Day != usage[j].Day {
+			return usage[i].Day < usage[j].Day
+		}
+		return usage[i].Model < usage[j].Model
+	})
+	return usage, nil
+}
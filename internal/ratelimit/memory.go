@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are dropped from a memory store.
+const sweepInterval = time.Minute
+
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+// NewMemoryStore returns a Store local to this process.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		buckets: make(map[string]*Bucket),
+	}
+}
+
+func (m *memoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// a full bucket is the same as no bucket, so they don't need to be kept
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		for k, b := range m.buckets {
+			if b.full(limit, now) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &Bucket{}
+		m.buckets[key] = b
+	}
+	return b.Take(limit, now), nil
+}
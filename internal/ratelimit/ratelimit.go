@@ -0,0 +1,87 @@
+// Package ratelimit implements token bucket rate limiting with pluggable
+// storage for the buckets, so several replicas can share a limit.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"stream/internal/persistence"
+	"time"
+)
+
+// Limit allows Burst requests at once, refilled at Rate requests per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute returns a limit of n requests per minute with the given burst.
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed    bool
+	Limit      int           // Size of the bucket
+	Remaining  int           // Tokens left after this request
+	RetryAfter time.Duration // Wait until the next token, zero when allowed
+	ResetAfter time.Duration // Wait until the bucket is full again
+}
+
+// Store keeps the buckets. Take must be atomic per key; a shared store
+// implements it server side (e.g. with a script) to enforce a common limit.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Bucket is the state of one token bucket. Stores persist it as is and use
+// Take to apply a request to it.
+type Bucket struct {
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+}
+
+// Take refills the bucket up to now and takes one token if available. A zero
+// Bucket is a full one.
+func (b *Bucket) Take(limit Limit, now time.Time) Result {
+	burst := float64(limit.Burst)
+	if b.Updated.IsZero() {
+		b.Tokens = burst
+	} else if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(burst, b.Tokens+elapsed*limit.Rate)
+	}
+	b.Updated = now
+
+	res := Result{Limit: limit.Burst}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - b.Tokens) / limit.Rate)
+	}
+	res.Remaining = int(b.Tokens)
+	res.ResetAfter = secondsToDuration((burst - b.Tokens) / limit.Rate)
+	return res
+}
+
+// full reports whether the bucket has refilled completely by now.
+func (b *Bucket) full(limit Limit, now time.Time) bool {
+	return b.Tokens+now.Sub(b.Updated).Seconds()*limit.Rate >= float64(limit.Burst)
+}
+
+func secondsToDuration(s float64) time.Duration {
+	if math.IsInf(s, 0) || math.IsNaN(s) {
+		return 0
+	}
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+func NewStore(t persistence.StorageType) Store {
+	switch t {
+	case persistence.MemoryStorage:
+		return NewMemoryStore()
+	default:
+		panic("unsupported persistence type")
+	}
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBucket_Take(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 3}
+	now := time.Unix(1000, 0)
+	var b Bucket
+
+	for i := 2; i >= 0; i-- {
+		res := b.Take(limit, now)
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("expected request to be allowed with %d remaining, got %+v", i, res)
+		}
+	}
+
+	res := b.Take(limit, now)
+	if res.Allowed {
+		t.Fatal("expected an empty bucket to deny the request")
+	}
+	if res.RetryAfter != time.Second || res.ResetAfter != 3*time.Second {
+		t.Fatalf("unexpected wait times: %+v", res)
+	}
+
+	// half a token isn't enough
+	if res := b.Take(limit, now.Add(500*time.Millisecond)); res.Allowed || res.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("expected to wait another 500ms, got %+v", res)
+	}
+	if res := b.Take(limit, now.Add(time.Second)); !res.Allowed {
+		t.Fatalf("expected a refilled token, got %+v", res)
+	}
+
+	// refills never exceed the burst
+	if res := b.Take(limit, now.Add(time.Hour)); !res.Allowed || res.Remaining != 2 {
+		t.Fatalf("expected a full bucket, got %+v", res)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 1}
+	now := time.Unix(1000, 0)
+	ctx := context.Background()
+
+	if res, _ := store.Take(ctx, "a", limit, now); !res.Allowed {
+		t.Fatal("expected first request of a to be allowed")
+	}
+	if res, _ := store.Take(ctx, "a", limit, now); res.Allowed {
+		t.Fatal("expected second request of a to be denied")
+	}
+	if res, _ := store.Take(ctx, "b", limit, now); !res.Allowed {
+		t.Fatal("expected keys to have separate buckets")
+	}
+
+	// idle buckets are swept without losing state of active ones
+	store.Take(ctx, "a", limit, now.Add(sweepInterval))
+	if n := len(store.(*memoryStore).buckets); n != 1 {
+		t.Fatalf("expected the idle bucket to be swept, %d left", n)
+	}
+}
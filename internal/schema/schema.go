@@ -0,0 +1,410 @@
+// Package schema implements the subset of JSON Schema used to validate
+// structured model output: types, object properties, arrays, enums, numeric
+// and length bounds, patterns, const and the anyOf/oneOf/allOf combinators.
+// Schemas using any other keyword (e.g. $ref, not or format) are rejected
+// rather than validated partially.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// Schema is a parsed JSON Schema document.
+type Schema struct {
+	Types                []string           // Allowed JSON types, empty means any
+	Properties           map[string]*Schema // Schemas of known object properties
+	Required             []string           // Properties that must be present
+	AdditionalProperties *Schema            // Schema for unknown properties, nil allows anything
+	NoAdditional         bool               // Reject unknown properties (additionalProperties: false)
+	Items                *Schema            // Schema every array item must match
+	Enum                 []any              // Allowed values
+	Const                *any               // The only allowed value
+	Minimum              *float64
+	Maximum              *float64
+	ExclusiveMinimum     *float64
+	ExclusiveMaximum     *float64
+	MinLength            *int
+	MaxLength            *int
+	MinItems             *int
+	MaxItems             *int
+	Pattern              *regexp.Regexp
+	AnyOf                []*Schema
+	OneOf                []*Schema
+	AllOf                []*Schema
+}
+
+// rawSchema mirrors the JSON representation of a Schema.
+type rawSchema struct {
+	Type                 json.RawMessage            `json:"type"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	Enum                 []any                      `json:"enum"`
+	Const                json.RawMessage            `json:"const"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	ExclusiveMinimum     *float64                   `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64                   `json:"exclusiveMaximum"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	Pattern              *string                    `json:"pattern"`
+	AnyOf                []json.RawMessage          `json:"anyOf"`
+	OneOf                []json.RawMessage          `json:"oneOf"`
+	AllOf                []json.RawMessage          `json:"allOf"`
+}
+
+// keywords are the keywords of rawSchema plus annotations, which don't
+// constrain anything.
+var keywords = map[string]bool{
+	"type": true, "properties": true, "required": true, "additionalProperties": true,
+	"items": true, "enum": true, "const": true, "minimum": true, "maximum": true,
+	"exclusiveMinimum": true, "exclusiveMaximum": true, "minLength": true,
+	"maxLength": true, "minItems": true, "maxItems": true, "pattern": true,
+	"anyOf": true, "oneOf": true, "allOf": true,
+
+	"$schema": true, "$id": true, "$comment": true, "title": true,
+	"description": true, "default": true, "examples": true, "deprecated": true,
+	"readOnly": true, "writeOnly": true,
+}
+
+var knownTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// Parse parses a JSON Schema document.
+func Parse(data []byte) (*Schema, error) {
+	return parse(data, "$")
+}
+
+func parse(data []byte, path string) (*Schema, error) {
+	// A boolean schema: true accepts everything, false is not supported.
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		if !b {
+			return nil, fmt.Errorf("%s: false schemas are not supported", path)
+		}
+		return &Schema{}, nil
+	}
+
+	var raw rawSchema
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	// a keyword we'd ignore would let through output the client doesn't accept
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var unsupported []string
+	for k := range all {
+		if !keywords[k] {
+			unsupported = append(unsupported, k)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return nil, fmt.Errorf("%s: unsupported keywords %q", path, unsupported)
+	}
+
+	s := &Schema{
+		Required:         raw.Required,
+		Enum:             raw.Enum,
+		Minimum:          raw.Minimum,
+		Maximum:          raw.Maximum,
+		ExclusiveMinimum: raw.ExclusiveMinimum,
+		ExclusiveMaximum: raw.ExclusiveMaximum,
+		MinLength:        raw.MinLength,
+		MaxLength:        raw.MaxLength,
+		MinItems:         raw.MinItems,
+		MaxItems:         raw.MaxItems,
+	}
+
+	if len(raw.Type) > 0 {
+		var single string
+		if err := json.Unmarshal(raw.Type, &single); err == nil {
+			s.Types = []string{single}
+		} else if err := json.Unmarshal(raw.Type, &s.Types); err != nil {
+			return nil, fmt.Errorf("%s.type: must be a string or an array of strings", path)
+		}
+		for _, t := range s.Types {
+			if !knownTypes[t] {
+				return nil, fmt.Errorf("%s.type: unknown type %q", path, t)
+			}
+		}
+	}
+
+	if len(raw.Properties) > 0 {
+		s.Properties = make(map[string]*Schema, len(raw.Properties))
+		for name, p := range raw.Properties {
+			ps, err := parse(p, path+".properties."+name)
+			if err != nil {
+				return nil, err
+			}
+			s.Properties[name] = ps
+		}
+	}
+
+	if len(raw.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(raw.AdditionalProperties, &allowed); err == nil {
+			s.NoAdditional = !allowed
+		} else {
+			ap, err := parse(raw.AdditionalProperties, path+".additionalProperties")
+			if err != nil {
+				return nil, err
+			}
+			s.AdditionalProperties = ap
+		}
+	}
+
+	if len(raw.Items) > 0 {
+		items, err := parse(raw.Items, path+".items")
+		if err != nil {
+			return nil, err
+		}
+		s.Items = items
+	}
+
+	if len(raw.Const) > 0 {
+		var c any
+		if err := json.Unmarshal(raw.Const, &c); err != nil {
+			return nil, fmt.Errorf("%s.const: %v", path, err)
+		}
+		s.Const = &c
+	}
+
+	if raw.Pattern != nil {
+		re, err := regexp.Compile(*raw.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s.pattern: %v", path, err)
+		}
+		s.Pattern = re
+	}
+
+	var err error
+	if s.AnyOf, err = parseAll(raw.AnyOf, path+".anyOf"); err != nil {
+		return nil, err
+	}
+	if s.OneOf, err = parseAll(raw.OneOf, path+".oneOf"); err != nil {
+		return nil, err
+	}
+	if s.AllOf, err = parseAll(raw.AllOf, path+".allOf"); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func parseAll(raws []json.RawMessage, path string) ([]*Schema, error) {
+	schemas := make([]*Schema, 0, len(raws))
+	for i, r := range raws {
+		s, err := parse(r, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas, nil
+}
+
+// Error is a single validation failure, located by a JSONPath-like path.
+type Error struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e Error) String() string {
+	return e.Path + ": " + e.Message
+}
+
+// Validate decodes doc as JSON and checks it against the schema. It returns
+// every violation found, or nil when the document is valid.
+func (s *Schema) Validate(doc []byte) []Error {
+	var v any
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return []Error{{Path: "$", Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	return s.validate(v, "$")
+}
+
+func (s *Schema) validate(v any, path string) []Error {
+	var errs []Error
+	fail := func(format string, args ...any) {
+		errs = append(errs, Error{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Types) > 0 && !s.matchesType(v) {
+		fail("expected %s, got %s", joinTypes(s.Types), typeOf(v))
+		return errs
+	}
+
+	if s.Const != nil && !reflect.DeepEqual(v, *s.Const) {
+		fail("must be %v", *s.Const)
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %v", s.Enum)
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		errs = append(errs, s.validateObject(val, path)...)
+	case []any:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				errs = append(errs, s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.Pattern != nil && !s.Pattern.MatchString(val) {
+			fail("must match pattern %q", s.Pattern.String())
+		}
+	case float64:
+		if s.Minimum != nil && val < *s.Minimum {
+			fail("must be >= %g", *s.Minimum)
+		}
+		if s.Maximum != nil && val > *s.Maximum {
+			fail("must be <= %g", *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && val <= *s.ExclusiveMinimum {
+			fail("must be > %g", *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && val >= *s.ExclusiveMaximum {
+			fail("must be < %g", *s.ExclusiveMaximum)
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		errs = append(errs, sub.validate(v, path)...)
+	}
+	if len(s.AnyOf) > 0 {
+		matched := false
+		for _, sub := range s.AnyOf {
+			if len(sub.validate(v, path)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("must match at least one schema in anyOf")
+		}
+	}
+	if len(s.OneOf) > 0 {
+		matches := 0
+		for _, sub := range s.OneOf {
+			if len(sub.validate(v, path)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			fail("must match exactly one schema in oneOf, matched %d", matches)
+		}
+	}
+
+	return errs
+}
+
+func (s *Schema) validateObject(obj map[string]any, path string) []Error {
+	var errs []Error
+
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			errs = append(errs, Error{Path: path, Message: fmt.Sprintf("missing required property %q", name)})
+		}
+	}
+
+	// Walk the properties in a stable order so errors are deterministic.
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propPath := path + "." + name
+		if ps, ok := s.Properties[name]; ok {
+			errs = append(errs, ps.validate(obj[name], propPath)...)
+			continue
+		}
+		switch {
+		case s.NoAdditional:
+			errs = append(errs, Error{Path: propPath, Message: "additional property is not allowed"})
+		case s.AdditionalProperties != nil:
+			errs = append(errs, s.AdditionalProperties.validate(obj[name], propPath)...)
+		}
+	}
+
+	return errs
+}
+
+func (s *Schema) matchesType(v any) bool {
+	actual := typeOf(v)
+	for _, t := range s.Types {
+		if t == actual {
+			return true
+		}
+		if t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if val == math.Trunc(val) && !math.IsInf(val, 0) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+func joinTypes(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return fmt.Sprintf("one of %v", types)
+}
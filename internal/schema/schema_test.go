@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+const personSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0},
+		"role": {"enum": ["admin", "user"]},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2}
+	},
+	"required": ["name", "age"],
+	"additionalProperties": false
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(personSchema))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+		errs []string
+	}{
+		{"valid", `{"name":"Ada","age":36,"role":"admin","tags":["x"]}`, nil},
+		{"missing required", `{"name":"Ada"}`, []string{`$: missing required property "age"`}},
+		{"wrong type", `{"name":"Ada","age":1.5}`, []string{"$.age: expected integer, got number"}},
+		{"enum", `{"name":"Ada","age":1,"role":"root"}`, []string{"$.role: must be one of [admin user]"}},
+		{"additional property", `{"name":"Ada","age":1,"extra":true}`, []string{"$.extra: additional property is not allowed"}},
+		{"array items", `{"name":"Ada","age":1,"tags":["a",2,"c"]}`, []string{"$.tags: must have at most 2 items", "$.tags[1]: expected string, got integer"}},
+		{"not json", `{"name":`, []string{"$: invalid JSON"}},
+		{"not an object", `[]`, []string{"$: expected object, got array"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := s.Validate([]byte(tt.doc))
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("expected %d errors, got %v", len(tt.errs), errs)
+			}
+			for i, e := range errs {
+				if !strings.HasPrefix(e.String(), tt.errs[i]) {
+					t.Errorf("error %d: expected %q, got %q", i, tt.errs[i], e.String())
+				}
+			}
+		})
+	}
+}
+
+func TestValidate_Combinators(t *testing.T) {
+	s, err := Parse([]byte(`{"anyOf":[{"type":"string","pattern":"^a"},{"type":"number","exclusiveMaximum":10}]}`))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	for doc, valid := range map[string]bool{`"abc"`: true, `5`: true, `"bcd"`: false, `10`: false, `null`: false} {
+		if got := len(s.Validate([]byte(doc))) == 0; got != valid {
+			t.Errorf("%s: expected valid=%v, got %v", doc, valid, got)
+		}
+	}
+}
+
+func TestValidate_Const(t *testing.T) {
+	s, err := Parse([]byte(`{"type":"object","properties":{"kind":{"const":"point"},"n":{"const":1}}}`))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	for doc, valid := range map[string]bool{`{"kind":"point","n":1}`: true, `{"kind":"line"}`: false, `{"n":2}`: false, `{"n":"1"}`: false} {
+		if got := len(s.Validate([]byte(doc))) == 0; got != valid {
+			t.Errorf("%s: expected valid=%v, got %v", doc, valid, got)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, doc := range []string{
+		`{"type":"float"}`, `{"pattern":"("}`, `{"properties":{"a":{"type":1}}}`, `false`, `[`,
+		// keywords that aren't enforced are refused, not ignored
+		`{"$defs":{"a":{"type":"string"}},"properties":{"a":{"$ref":"#/$defs/a"}}}`,
+		`{"not":{"type":"string"}}`,
+		`{"type":"string","format":"email"}`,
+		`{"type":"object","minProperties":1}`,
+		`{"items":{"prefixItems":[{"type":"string"}]}}`,
+	} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("%s: expected an error", doc)
+		}
+	}
+}
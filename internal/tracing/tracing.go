@@ -0,0 +1,274 @@
+// Package tracing records spans following the OpenTelemetry model and
+// propagates them with W3C Trace Context (traceparent) headers. Spans are
+// handed to an Exporter when they end; see InMemoryExporter, WriterExporter
+// and OTLPExporter.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Attribute is a key-value pair describing a span or an event.
+type Attribute struct {
+	Key   string
+	Value any // string, int64, float64 or bool
+}
+
+func String(key, value string) Attribute    { return Attribute{key, value} }
+func Int(key string, value int) Attribute   { return Attribute{key, int64(value)} }
+func Float(key string, v float64) Attribute { return Attribute{key, v} }
+func Bool(key string, value bool) Attribute { return Attribute{key, value} }
+
+// Event is something that happened at a point in time during a span.
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes []Attribute
+}
+
+// StatusCode tells whether the operation of a span succeeded.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+// SpanKind tells the role of a span in a request.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = iota
+	KindServer            // Serves a request
+	KindClient            // Makes a request to another service
+)
+
+// SpanData is a snapshot of an ended span, as handed to exporters.
+type SpanData struct {
+	Name          string
+	SpanContext   SpanContext
+	Parent        SpanID // Zero for a root span
+	Kind          SpanKind
+	Start, End    time.Time
+	Attributes    []Attribute
+	Events        []Event
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Span is an operation being traced. The methods of a nil *Span do nothing,
+// so code doesn't need to check whether tracing is on.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns the identity of the span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetName replaces the name the span was started with.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+// SetAttributes adds attributes to the span, replacing those with the same key.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range attrs {
+		replaced := false
+		for i := range s.data.Attributes {
+			if s.data.Attributes[i].Key == a.Key {
+				s.data.Attributes[i], replaced = a, true
+				break
+			}
+		}
+		if !replaced {
+			s.data.Attributes = append(s.data.Attributes, a)
+		}
+	}
+}
+
+// AddEvent records an event at the current time.
+func (s *Span) AddEvent(name string, attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Events = append(s.data.Events, Event{Name: name, Time: time.Now(), Attributes: attrs})
+}
+
+// RecordError marks the span as failed with err. A nil err does nothing.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.AddEvent("exception", String("exception.message", err.Error()))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status, s.data.StatusMessage = StatusError, err.Error()
+}
+
+// SetStatus sets the outcome of the span.
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status, s.data.StatusMessage = code, message
+}
+
+// End ends the span and exports it. Only the first call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	data.Attributes = append([]Attribute(nil), s.data.Attributes...)
+	data.Events = append([]Event(nil), s.data.Events...)
+	s.mu.Unlock()
+
+	if data.SpanContext.Sampled {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+// Exporter receives ended spans. Export must not block for long, exporters
+// that send spans elsewhere batch them.
+type Exporter interface {
+	Export(span SpanData)
+	// Shutdown flushes the spans not exported yet.
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer starts spans and exports them once they end. A nil *Tracer starts
+// nil spans, which turns tracing off.
+type Tracer struct {
+	exporter Exporter
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// Start starts a span that is a child of the span of ctx, or of the remote
+// span extracted into ctx, and returns a copy of ctx carrying the new span.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return t.StartKind(ctx, name, KindInternal, attrs...)
+}
+
+// StartKind starts a span of the given kind, see Start.
+func (t *Tracer) StartKind(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{TraceID: parent.TraceID, SpanID: newSpanID(), Sampled: true}
+	if parent.IsValid() {
+		sc.Sampled = parent.Sampled
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+
+	s := &Span{tracer: t, data: SpanData{
+		Name:        name,
+		SpanContext: sc,
+		Parent:      parent.SpanID,
+		Kind:        kind,
+		Start:       time.Now(),
+		Attributes:  append([]Attribute(nil), attrs...),
+	}}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Shutdown flushes the spans not exported yet.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SpanContextFromContext returns the identity of the span of ctx, or of the
+// remote span extracted into ctx.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx in which spans are
+// started as children of sc, a span of another process.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
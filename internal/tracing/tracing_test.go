@@ -0,0 +1,143 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const h = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(h)
+	if !ok {
+		t.Fatalf("ParseTraceparent(%q) failed", h)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Errorf("ParseTraceparent(%q) = %+v", h, sc)
+	}
+	if got := sc.Traceparent(); got != h {
+		t.Errorf("Traceparent() = %q; want %q", got, h)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-zbf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		// over-long IDs must not overflow the arrays they are decoded into
+		"00-4bf92f3577b34da6a3ce929d0e0e473600-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b700-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0123456789abcdef0123456789abcdef-01",
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("ParseTraceparent(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestTracer_Start(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter)
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := Extract(context.Background(), header)
+
+	ctx, parent := tracer.StartKind(ctx, "parent", KindServer)
+	_, child := tracer.Start(ctx, "child", String("key", "value"))
+	child.RecordError(errors.New("boom"))
+	child.End()
+	child.End()
+	parent.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans; want 2", len(spans))
+	}
+	c, p := spans[0], spans[1]
+	if p.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || p.Parent.String() != "00f067aa0ba902b7" {
+		t.Errorf("parent = %+v; want it to continue the remote trace", p)
+	}
+	if c.SpanContext.TraceID != p.SpanContext.TraceID || c.Parent != p.SpanContext.SpanID {
+		t.Errorf("child = %+v; want a child of %+v", c, p.SpanContext)
+	}
+	if c.Status != StatusError || c.StatusMessage != "boom" || len(c.Events) != 1 {
+		t.Errorf("child status = %v %q, events %v; want the recorded error", c.Status, c.StatusMessage, c.Events)
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	if want := parent.SpanContext().Traceparent(); out.Get("traceparent") != want {
+		t.Errorf("injected traceparent = %q; want %q", out.Get("traceparent"), want)
+	}
+}
+
+func TestTracer_Unsampled(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter)
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := tracer.Start(Extract(context.Background(), header), "span")
+	span.End()
+
+	if n := len(exporter.Spans()); n != 0 {
+		t.Errorf("exported %d spans of an unsampled trace; want 0", n)
+	}
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "span")
+	span.SetAttributes(Int("n", 1))
+	span.End()
+	if SpanFromContext(ctx) != nil {
+		t.Error("a nil tracer put a span in the context")
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var got otlpTraces
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode export: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	exporter := NewOTLPExporter("stream", server.URL, func(err error) { t.Error(err) })
+	tracer := NewTracer(exporter)
+	_, span := tracer.StartKind(context.Background(), "groq.SendMessage", KindClient, Int("tokens", 42))
+	span.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("export = %+v; want one resource and scope", got)
+	}
+	if attrs := got.ResourceSpans[0].Resource.Attributes; len(attrs) != 1 || attrs[0].Value["stringValue"] != "stream" {
+		t.Errorf("resource attributes = %+v; want service.name", attrs)
+	}
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 {
+		t.Fatalf("exported %d spans; want 1", len(spans))
+	}
+	s := spans[0]
+	if s.Name != "groq.SendMessage" || s.Kind != 3 || s.TraceID != span.SpanContext().TraceID.String() || s.ParentSpanID != "" {
+		t.Errorf("span = %+v", s)
+	}
+	if len(s.Attributes) != 1 || s.Attributes[0].Value["intValue"] != "42" {
+		t.Errorf("attributes = %+v; want tokens as an intValue string", s.Attributes)
+	}
+}
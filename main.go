@@ -2,12 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"os"
 	"os/signal"
+	"stream/internal/api"
 	"stream/internal/app"
+	"stream/internal/audit"
+	"stream/internal/chat"
 	"stream/internal/config"
+	"stream/internal/jwt"
+	"stream/internal/metrics"
 	"stream/internal/persistence"
+	"stream/internal/ratelimit"
+	"stream/internal/tracing"
 	"stream/pkg/logger"
+	"syscall"
+	"time"
 )
 
 //	@title			Stream Service API
@@ -16,21 +27,188 @@ import (
 
 // @host	localhost:8080
 func main() {
-	err := config.ReadEnv()
+	os.Exit(run())
+}
+
+// run runs the service until it is stopped and returns the exit code, so the
+// logs are flushed and the audit file closed whichever way it ends.
+func run() int {
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
 	if err != nil {
-		logger.Error.Printf("failed to read environment variables: %v", err)
-		os.Exit(1)
+		logger.Error.Printf("failed to load configuration: %v", err)
+		return 1
 	}
 
-	log := logger.NewStdLogger(logger.Info)
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	log, err := logger.NewFormat(os.Stderr, cfg.LogFormat)
+	if err != nil {
+		logger.Error.Printf("failed to create logger: %v", err)
+		return 1
+	}
+	logger.SetLevel(cfg.LogLevel)
+	sinks, err := logSinks(cfg.LogSinks)
+	if err != nil {
+		log.Error("failed to open log sinks", "error", err)
+		return 1
+	}
+	if sinks != nil {
+		logger.Register(sinks)
+		defer logger.Flush()
+	}
+	log.Info("configuration loaded", "config", cfg.String())
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	db := persistence.NewPersistence(persistence.MemoryStorage)
+	live := config.NewLive(log, cfg, func() (config.Config, error) { return config.Load(os.Args[1:]) })
+	// only a change of LOG_LEVEL overrides a level set with PUT /admin/log-level
+	level := cfg.LogLevel
+	live.OnChange(func(c *config.Config) {
+		if c.LogLevel != level {
+			level = c.LogLevel
+			logger.SetLevel(level)
+		}
+	})
+	if cfg.ReloadInterval > 0 {
+		go live.Watch(ctx, cfg.ReloadInterval)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Info("reloading configuration on SIGHUP")
+			live.Reload()
+		}
+	}()
+
+	var tracer *tracing.Tracer
+	switch tc := cfg.Tracing; tc.Exporter {
+	case "stdout":
+		tracer = tracing.NewTracer(tracing.NewWriterExporter(tc.ServiceName, os.Stdout))
+	case "otlp":
+		tracer = tracing.NewTracer(tracing.NewOTLPExporter(tc.ServiceName, tc.OTLPEndpoint, func(err error) {
+			log.Warn("failed to export spans", "error", err)
+		}))
+	}
+
+	m := metrics.New()
+	db := persistence.InstrumentConversationStore(persistence.NewPersistence(persistence.MemoryStorage), m.ObserveStoreOp)
+	images := persistence.InstrumentImageStore(persistence.NewImageStore(persistence.MemoryStorage, int64(cfg.ImageStoreMaxMB)<<20), m.ObserveStoreOp)
+
+	keys := persistence.NewAPIKeyStore(persistence.MemoryStorage)
+	n, err := api.LoadAPIKeys(keys, cfg.Auth.APIKeys.Reveal())
+	if err != nil {
+		log.Error("failed to load API keys", "error", err)
+		return 1
+	}
+
+	var verifier *jwt.Verifier
+	if cfg.Auth.JWKSURL != "" {
+		jwks := jwt.NewJWKS(cfg.Auth.JWKSURL, jwt.DefaultRefreshInterval)
+		jwks.OnSkippedKey = func(err error) { log.Warn("ignoring JWT signing key", "error", err) }
+		verifier = jwt.NewVerifier(jwks, jwt.Config{
+			Issuer:    cfg.Auth.JWTIssuer,
+			Audience:  cfg.Auth.JWTAudience,
+			UserClaim: cfg.Auth.JWTUserClaim,
+			Leeway:    time.Minute,
+		})
+	}
+	if n == 0 && verifier == nil {
+		log.Warn("neither API_KEYS nor JWKS_URL are configured, every authenticated request will be rejected")
+	}
+
+	buckets := ratelimit.NewStore(persistence.MemoryStorage)
+	limiter := api.RateLimit(log, buckets, func() ratelimit.Limit {
+		c := live.Get().RateLimit
+		return ratelimit.PerMinute(c.PerMinute, c.Burst)
+	})
+	// requests aren't authenticated yet, RateLimit keys them by IP address
+	ipLimiter := api.RateLimit(log, buckets, func() ratelimit.Limit {
+		c := live.Get().RateLimit
+		return ratelimit.PerMinute(c.IPPerMinute, c.IPBurst)
+	})
+	if cfg.RateLimit.PerMinute == 0 {
+		log.Warn("rate limiting is disabled")
+	}
+
+	acct := api.Accounting{
+		Usage: persistence.InstrumentUsageStore(persistence.NewUsageStore(persistence.MemoryStorage), m.ObserveStoreOp),
+	}
+	if path := cfg.Budget.PricingFile; path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Error("failed to read pricing", "error", err)
+			return 1
+		}
+		if acct.Pricing, err = chat.ParsePricing(data); err != nil {
+			log.Error("failed to parse pricing", "file", path, "error", err)
+			return 1
+		}
+	}
+	if url := cfg.Budget.WebhookURL.Reveal(); url != "" {
+		acct.Alerter = api.NewWebhookAlerter(url)
+	}
+
+	var trail *audit.Trail
+	if path := cfg.Audit.File; path != "" {
+		redactor, err := audit.NewRedactor(cfg.Audit.Redact, cfg.Audit.RedactPattern)
+		if err != nil {
+			log.Error("failed to create audit redactor", "error", err)
+			return 1
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			log.Error("failed to open audit file", "error", err)
+			return 1
+		}
+		defer f.Close()
+		trail = audit.New(f, audit.Options{Redactor: redactor, HashContent: cfg.Audit.HashContent})
+	}
 
-	a := app.New(log, db)
+	a := app.New(log, live, db, images, acct, api.Authenticate(log, keys, verifier), limiter, ipLimiter, m, tracer, trail)
+
+	err = a.Run(ctx)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	if err := tracer.Shutdown(shutdownCtx); err != nil {
+		log.Warn("failed to flush spans", "error", err)
+	}
+	cancelShutdown()
+	if err != nil {
+		log.Error("failed to start server", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// logSinks returns the sinks logs are sent to besides stderr, or nil.
+func logSinks(c config.LogSinks) (logger.ExternalLogger, error) {
+	var sinks []logger.ExternalLogger
+	if c.File != "" {
+		f, err := logger.OpenRotatingFile(c.File, logger.RotateConfig{
+			MaxSize:    int64(c.FileMaxSizeMB) << 20,
+			Interval:   c.FileRotate,
+			MaxBackups: c.FileMaxBackups,
+			MaxAge:     c.FileMaxAge,
+			Compress:   c.FileCompress,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, f)
+	}
+	if url := c.ShipURL.Reveal(); url != "" {
+		sinks = append(sinks, logger.NewHTTPSink(url, logger.ShipConfig{
+			BatchSize:     c.ShipBatchSize,
+			FlushInterval: c.ShipInterval,
+		}))
+	}
 
-	if err := a.Run(ctx); err != nil {
-		log.Fatalf("failed to start server: %v", err)
+	switch len(sinks) {
+	case 0:
+		return nil, nil
+	case 1:
+		return sinks[0], nil
 	}
+	return logger.Tee(sinks...), nil
 }
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+type contextKey struct{}
+
+// contextLogger is the logger of a request. It is shared by everything the
+// request's context reaches, so fields added deep down, such as the user
+// once authenticated, also show on the lines logged by the middleware above.
+type contextLogger struct {
+	mu sync.Mutex
+	l  Structured
+}
+
+// NewContext returns a copy of ctx carrying l, see FromContext and AddFields.
+func NewContext(ctx context.Context, l Structured) context.Context {
+	return context.WithValue(ctx, contextKey{}, &contextLogger{l: l})
+}
+
+// FromContext returns the logger carried by ctx.
+func FromContext(ctx context.Context) (Structured, bool) {
+	c, ok := ctx.Value(contextKey{}).(*contextLogger)
+	if !ok {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.l, true
+}
+
+// AddFields adds args to every message logged from now on with the logger
+// carried by ctx, by any holder of the context. Without a logger it does
+// nothing.
+func AddFields(ctx context.Context, args ...any) {
+	c, ok := ctx.Value(contextKey{}).(*contextLogger)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.l = c.l.With(args...)
+}
+
+// SetContextLevel makes the logger carried by ctx log at level from now on,
+// whatever the level set with SetLevel, see WithLevel. Without a logger it
+// does nothing.
+func SetContextLevel(ctx context.Context, level Level) {
+	c, ok := ctx.Value(contextKey{}).(*contextLogger)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.l = WithLevel(c.l, level)
+}
+
+// Adapt returns l as a Structured logger. A logger that isn't structured
+// already gets the messages as "msg=... key=value" lines through Print.
+func Adapt(l Logger) Structured {
+	if s, ok := l.(Structured); ok {
+		return s
+	}
+	return New(slog.NewTextHandler(printWriter{l}, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{} // l adds its own timestamp
+			}
+			return a
+		},
+	}))
+}
+
+type printWriter struct {
+	l Logger
+}
+
+func (w printWriter) Write(b []byte) (int, error) {
+	w.l.Print(strings.TrimSuffix(string(b), "\n"))
+	return len(b), nil
+}
@@ -40,6 +40,7 @@ type Level int
 const (
 	DebugLevel Level = iota
 	InfoLevel
+	WarnLevel
 	ErrorLevel
 	DisabledLevel
 )
@@ -240,6 +241,8 @@ func toString(level Level) string {
 		return "info"
 	case DebugLevel:
 		return "debug"
+	case WarnLevel:
+		return "warn"
 	case ErrorLevel:
 		return "error"
 	case DisabledLevel:
@@ -254,6 +257,8 @@ func toLevel(level string) (Level, error) {
 		return InfoLevel, nil
 	case "debug":
 		return DebugLevel, nil
+	case "warn":
+		return WarnLevel, nil
 	case "error":
 		return ErrorLevel, nil
 	case "disabled":
@@ -0,0 +1,274 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateConfig tells when a RotatingFile is rotated and how long rotated
+// files are kept. Zero values turn the matching limit off.
+type RotateConfig struct {
+	MaxSize    int64         // Bytes a file may grow to before it is rotated
+	Interval   time.Duration // Age at which a file is rotated
+	MaxBackups int           // Rotated files kept, the oldest are removed first
+	MaxAge     time.Duration // Rotated files older than this are removed
+	Compress   bool          // Gzip rotated files
+}
+
+// backupLayout is the time format in the names of rotated files, which sorts
+// in time order.
+const backupLayout = "20060102T150405.000"
+
+// RotatingFile is an io.Writer appending to a file that is renamed, as
+// name-<time>.ext, once it gets too big or too old, and replaced by a new one.
+// Rotated files are compressed and removed in the background.
+//
+// It is also an ExternalLogger writing a JSON object per line.
+type RotatingFile struct {
+	path string
+	cfg  RotateConfig
+	now  func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	background sync.WaitGroup // Compression and removal of rotated files
+	cleanup    sync.Mutex     // Serializes the background work
+}
+
+// OpenRotatingFile opens the file at path, creating it and its directory if
+// needed, and appends to it.
+func OpenRotatingFile(path string, cfg RotateConfig) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, cfg: cfg, now: time.Now}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file at f.path for appending. The caller must hold f.mu.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), f.now()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p would take it over
+// MaxSize or it is older than Interval.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	tooBig := f.cfg.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.cfg.MaxSize
+	tooOld := f.cfg.Interval > 0 && f.now().Sub(f.opened) >= f.cfg.Interval
+	if tooBig || tooOld {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Log implements ExternalLogger.
+func (f *RotatingFile) Log(level Level, msg string) {
+	if _, err := f.Write(jsonLine(f.now(), level, msg)); err != nil {
+		logLocal("failed to write log file: %v", err)
+	}
+}
+
+// Flush implements ExternalLogger. It commits the file to disk and waits for
+// rotated files to be compressed.
+func (f *RotatingFile) Flush() {
+	f.mu.Lock()
+	if f.file != nil {
+		f.file.Sync()
+	}
+	f.mu.Unlock()
+	f.background.Wait()
+}
+
+// Rotate rotates the file now.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// Close closes the file, after the background work is done.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	err := f.file.Close()
+	f.file = nil
+	f.background.Wait()
+	return err
+}
+
+// rotate renames the file and opens a new one. The caller must hold f.mu.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	now := f.now()
+	backup := f.backupName(now)
+	if err := os.Rename(f.path, backup); err != nil {
+		// keep appending to the current file rather than losing logs
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.background.Add(1)
+	go func() {
+		defer f.background.Done()
+		f.cleanup.Lock()
+		defer f.cleanup.Unlock()
+		if f.cfg.Compress {
+			if err := compress(backup); err != nil {
+				logLocal("failed to compress rotated log file: %v", err)
+			}
+		}
+		f.removeOld(now)
+	}()
+	return nil
+}
+
+// backupName returns the name of the file rotated at t.
+func (f *RotatingFile) backupName(t time.Time) string {
+	dir, base := filepath.Split(f.path)
+	ext := filepath.Ext(base)
+	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", strings.TrimSuffix(base, ext), t.UTC().Format(backupLayout), ext))
+}
+
+// backups returns the rotated files, newest first, and when they were rotated.
+func (f *RotatingFile) backups() ([]string, []time.Time, error) {
+	dir, base := filepath.Split(f.path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, nil, err
+	}
+	type backup struct {
+		name string
+		at   time.Time
+	}
+	var found []backup
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) || e.IsDir() {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz"), ext)
+		at, err := time.Parse(backupLayout, stamp)
+		if err != nil {
+			continue
+		}
+		found = append(found, backup{filepath.Join(dir, name), at})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].at.After(found[j].at) })
+
+	names, times := make([]string, len(found)), make([]time.Time, len(found))
+	for i, b := range found {
+		names[i], times[i] = b.name, b.at
+	}
+	return names, times, nil
+}
+
+// removeOld removes the rotated files beyond MaxBackups or older than MaxAge
+// at now.
+func (f *RotatingFile) removeOld(now time.Time) {
+	if f.cfg.MaxBackups <= 0 && f.cfg.MaxAge <= 0 {
+		return
+	}
+	names, times, err := f.backups()
+	if err != nil {
+		logLocal("failed to list rotated log files: %v", err)
+		return
+	}
+	for i, name := range names {
+		tooMany := f.cfg.MaxBackups > 0 && i >= f.cfg.MaxBackups
+		tooOld := f.cfg.MaxAge > 0 && now.Sub(times[i]) > f.cfg.MaxAge
+		if tooMany || tooOld {
+			if err := os.Remove(name); err != nil {
+				logLocal("failed to remove rotated log file: %v", err)
+			}
+		}
+	}
+}
+
+// compress gzips the file at path into path.gz and removes it.
+func compress(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
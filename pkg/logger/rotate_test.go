@@ -0,0 +1,85 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile_Size(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "stream.log")
+	f, err := OpenRotatingFile(path, RotateConfig{MaxSize: 10, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	clock := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return clock }
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		clock = clock.Add(time.Second)
+	}
+	f.Flush()
+
+	if got, _ := os.ReadFile(path); string(got) != "fourth\n" {
+		t.Errorf("current file = %q; want the last line", got)
+	}
+	names, _, err := f.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("backups = %v; want the 2 newest", names)
+	}
+	if want := filepath.Join(dir, "stream-20261019T120003.000.log.gz"); names[0] != want {
+		t.Errorf("newest backup = %s; want %s", names[0], want)
+	}
+
+	zf, err := os.Open(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zf.Close()
+	zr, err := gzip.NewReader(zf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != "third\n" {
+		t.Errorf("newest backup holds %q; want %q", got, "third\n")
+	}
+}
+
+func TestRotatingFile_Age(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "stream.log")
+	f, err := OpenRotatingFile(path, RotateConfig{Interval: time.Hour, MaxAge: 30 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	clock := time.Now()
+	f.now = func() time.Time { return clock }
+	f.Log(InfoLevel, "one")
+	clock = clock.Add(time.Hour)
+	f.Log(WarnLevel, "two")
+	clock = clock.Add(time.Hour)
+	f.Log(ErrorLevel, "three")
+	f.Flush()
+
+	names, _, _ := f.backups()
+	if len(names) != 1 {
+		t.Fatalf("backups = %v; want the one rotated within MaxAge", names)
+	}
+	got, _ := os.ReadFile(names[0])
+	if !strings.Contains(string(got), `"level":"warn","msg":"two"`) {
+		t.Errorf("backup = %s; want the second line as JSON", got)
+	}
+}
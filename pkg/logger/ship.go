@@ -0,0 +1,198 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ShipConfig tunes an HTTPSink. Zero values use the defaults.
+type ShipConfig struct {
+	BatchSize     int           // Lines sent per request, 100 by default
+	FlushInterval time.Duration // How often lines are sent, 5s by default
+	MaxBuffer     int           // Lines kept while the collector fails, the oldest are dropped; 10000 by default
+	MaxBackoff    time.Duration // Longest wait between failed attempts, 1m by default
+	FlushTimeout  time.Duration // How long Flush may take, 5s by default
+	Client        *http.Client
+}
+
+func (c ShipConfig) withDefaults() ShipConfig {
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = 5 * time.Second
+	}
+	if c.MaxBuffer <= 0 {
+		c.MaxBuffer = 10000
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = time.Minute
+	}
+	if c.FlushTimeout <= 0 {
+		c.FlushTimeout = 5 * time.Second
+	}
+	if c.Client == nil {
+		c.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return c
+}
+
+// HTTPSink is an ExternalLogger that POSTs messages as JSON lines
+// (application/x-ndjson) to a collector, in batches. When the collector
+// fails, it retries with exponential backoff and keeps up to MaxBuffer lines.
+type HTTPSink struct {
+	url string
+	cfg ShipConfig
+
+	mu      sync.Mutex
+	lines   [][]byte
+	dropped int // Lines dropped since the last report
+	shifted int // Lines dropped in total, to tell which of a batch are still buffered
+
+	sending sync.Mutex // Held while lines are sent, to keep them in order
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	closing sync.Once
+}
+
+// NewHTTPSink returns a sink sending to url, and starts sending.
+func NewHTTPSink(url string, cfg ShipConfig) *HTTPSink {
+	s := &HTTPSink{
+		url:     url,
+		cfg:     cfg.withDefaults(),
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Log implements ExternalLogger.
+func (s *HTTPSink) Log(level Level, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.lines) >= s.cfg.MaxBuffer {
+		s.lines = s.lines[1:]
+		s.dropped++
+		s.shifted++
+	}
+	s.lines = append(s.lines, jsonLine(time.Now(), level, msg))
+	if len(s.lines) >= s.cfg.BatchSize {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush implements ExternalLogger. It sends the buffered lines, giving up
+// after FlushTimeout.
+func (s *HTTPSink) Flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.FlushTimeout)
+	defer cancel()
+	if err := s.send(ctx); err != nil {
+		logLocal("failed to flush logs: %v", err)
+	}
+}
+
+// Close stops sending after flushing the buffered lines.
+func (s *HTTPSink) Close() error {
+	s.closing.Do(func() { close(s.done) })
+	<-s.stopped
+	s.Flush()
+	return nil
+}
+
+func (s *HTTPSink) run() {
+	defer close(s.stopped)
+	timer := time.NewTimer(s.cfg.FlushInterval)
+	defer timer.Stop()
+
+	var backoff time.Duration
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.kick:
+			if backoff > 0 {
+				continue // Wait for the retry
+			}
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		if err := s.send(context.Background()); err != nil {
+			backoff = min(max(2*backoff, time.Second), s.cfg.MaxBackoff)
+			logLocal("failed to ship logs, retrying in %v: %v", backoff, err)
+			timer.Reset(backoff)
+			continue
+		}
+		backoff = 0
+		timer.Reset(s.cfg.FlushInterval)
+	}
+}
+
+// send sends the buffered lines, in batches, until none are left or a batch
+// fails. Lines are only removed from the buffer once they were sent.
+func (s *HTTPSink) send(ctx context.Context) error {
+	s.sending.Lock()
+	defer s.sending.Unlock()
+
+	for {
+		s.mu.Lock()
+		if s.dropped > 0 {
+			logLocal("dropped %d log lines, the collector is not keeping up", s.dropped)
+			s.dropped = 0
+		}
+		n := min(len(s.lines), s.cfg.BatchSize)
+		batch := bytes.Join(s.lines[:n], nil)
+		shifted := s.shifted
+		s.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+
+		if err := s.post(ctx, batch); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		// Log may have dropped some of the batch to make room meanwhile
+		sent := max(n-(s.shifted-shifted), 0)
+		s.lines = s.lines[sent:]
+		s.mu.Unlock()
+	}
+}
+
+func (s *HTTPSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	res, err := s.cfg.Client.Do(req)
+	if err != nil {
+		// the URL may hold credentials, keep it out of the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to reach collector: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("collector returned %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	return nil
+}
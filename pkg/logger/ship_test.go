@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPSink(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		fail    = true
+		batches [][]string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var batch []string
+		for sc := bufio.NewScanner(r.Body); sc.Scan(); {
+			var entry struct{ Level, Msg string }
+			if err := json.Unmarshal(sc.Bytes(), &entry); err != nil {
+				t.Errorf("invalid line %q: %v", sc.Text(), err)
+			}
+			batch = append(batch, entry.Level+": "+entry.Msg)
+		}
+		batches = append(batches, batch)
+	}))
+	defer collector.Close()
+
+	sink := NewHTTPSink(collector.URL, ShipConfig{BatchSize: 2, MaxBuffer: 3, FlushInterval: time.Hour})
+	defer sink.Close()
+
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		sink.Log(InfoLevel, msg)
+	}
+	// the collector fails, so the lines are kept, up to MaxBuffer
+	sink.Flush()
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	sink.Log(ErrorLevel, "five\n")
+	sink.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := [][]string{{"info: three", "info: four"}, {"error: five"}}
+	if len(batches) != len(want) {
+		t.Fatalf("batches = %q; want %q", batches, want)
+	}
+	for i := range want {
+		if len(batches[i]) != len(want[i]) || batches[i][0] != want[i][0] {
+			t.Errorf("batch %d = %q; want %q", i, batches[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// jsonLine encodes a message passed to an ExternalLogger as a line of JSON,
+// {"time":...,"level":...,"msg":...}, terminated by a newline.
+func jsonLine(t time.Time, level Level, msg string) []byte {
+	line, _ := json.Marshal(struct {
+		Time  string `json:"time"`
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}{t.UTC().Format(time.RFC3339Nano), toString(level), strings.TrimSuffix(msg, "\n")})
+	return append(line, '\n')
+}
+
+// Tee returns an ExternalLogger passing every message to each of loggers, so
+// that more than one can be registered.
+func Tee(loggers ...ExternalLogger) ExternalLogger {
+	return tee(loggers)
+}
+
+type tee []ExternalLogger
+
+func (t tee) Log(level Level, msg string) {
+	for _, l := range t {
+		l.Log(level, msg)
+	}
+}
+
+func (t tee) Flush() {
+	for _, l := range t {
+		l.Flush()
+	}
+}
+
+// logLocal reports a problem of an external logger with the default logger
+// only, as the external logger may be what is failing.
+func logLocal(format string, v ...interface{}) {
+	if g := globals(); g.defaultLogger != nil {
+		g.defaultLogger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,191 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Structured is a leveled logger that attaches key-value fields to its
+// messages. Fields are passed as alternating keys and values, or as slog.Attr,
+// like with log/slog. It also implements Logger: Printf and friends log at
+// info level.
+//
+// Messages below the level set with SetLevel are dropped, and messages that
+// are logged are passed to the registered ExternalLogger as well.
+type Structured interface {
+	Logger
+
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+
+	// With returns a logger that adds args to every message.
+	With(args ...any) Structured
+
+	// Slog returns the underlying slog.Logger.
+	Slog() *slog.Logger
+}
+
+// New returns a structured logger writing to h.
+func New(h slog.Handler) Structured {
+	return &structured{slog.New(&levelHandler{next: h})}
+}
+
+// NewText returns a structured logger writing key=value lines to w.
+func NewText(w io.Writer) Structured {
+	return New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// NewJSON returns a structured logger writing a JSON object per line to w.
+func NewJSON(w io.Writer) Structured {
+	return New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// NewFormat returns a structured logger writing to w in format, "text" or "json".
+func NewFormat(w io.Writer, format string) (Structured, error) {
+	switch format {
+	case "text":
+		return NewText(w), nil
+	case "json":
+		return NewJSON(w), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q", format)
+}
+
+type structured struct {
+	l *slog.Logger
+}
+
+var _ Structured = (*structured)(nil)
+
+func (s *structured) Debug(msg string, args ...any) { s.l.Debug(msg, args...) }
+func (s *structured) Info(msg string, args ...any)  { s.l.Info(msg, args...) }
+func (s *structured) Warn(msg string, args ...any)  { s.l.Warn(msg, args...) }
+func (s *structured) Error(msg string, args ...any) { s.l.Error(msg, args...) }
+
+func (s *structured) With(args ...any) Structured { return &structured{s.l.With(args...)} }
+
+func (s *structured) Slog() *slog.Logger { return s.l }
+
+// Printf writes a formatted message at info level.
+func (s *structured) Printf(format string, v ...interface{}) { s.l.Info(fmt.Sprintf(format, v...)) }
+
+// Print writes a message at info level.
+func (s *structured) Print(v ...interface{}) { s.l.Info(fmt.Sprint(v...)) }
+
+// Println writes a message at info level.
+func (s *structured) Println(v ...interface{}) {
+	s.l.Info(strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+}
+
+// Fatal writes a message at error level and exits, regardless of the current level.
+func (s *structured) Fatal(v ...interface{}) { s.fatal(fmt.Sprint(v...)) }
+
+// Fatalf writes a formatted message at error level and exits, regardless of
+// the current level.
+func (s *structured) Fatalf(format string, v ...interface{}) { s.fatal(fmt.Sprintf(format, v...)) }
+
+func (s *structured) fatal(msg string) {
+	ctx := context.WithValue(context.Background(), fatalKey{}, true)
+	s.l.Log(ctx, slog.LevelError, msg)
+	Flush()
+	os.Exit(1)
+}
+
+// WithLevel returns a logger like l that logs at level whatever the level set
+// with SetLevel, e.g. to debug a single request. Loggers not made by this
+// package are returned as is.
+func WithLevel(l Structured, level Level) Structured {
+	s, ok := l.(*structured)
+	if !ok {
+		return l
+	}
+	h, ok := s.l.Handler().(*levelHandler)
+	if !ok {
+		return l
+	}
+	c := *h
+	c.level = &level
+	return &structured{slog.New(&c)}
+}
+
+// fatalKey marks records that are logged whatever the current level.
+type fatalKey struct{}
+
+// levelHandler applies the package's current level to a slog.Handler and
+// forwards the records that pass to the external logger.
+type levelHandler struct {
+	next   slog.Handler
+	attrs  []slog.Attr // Added with WithAttrs, for the external logger
+	prefix string      // Group of the attributes added next
+	level  *Level      // Overrides the current level, see WithLevel
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if fatal, _ := ctx.Value(fatalKey{}).(bool); fatal {
+		return true
+	}
+	threshold := globals().currentLevel
+	if h.level != nil {
+		threshold = *h.level
+	}
+	return fromSlog(level) >= threshold && h.next.Enabled(ctx, level)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	if g := globals(); g.external != nil {
+		g.external.Log(fromSlog(r.Level), h.format(r))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.next = h.next.WithAttrs(attrs)
+	c.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		a.Key = h.prefix + a.Key
+		c.attrs = append(c.attrs, a)
+	}
+	return &c
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.next = h.next.WithGroup(name)
+	c.prefix = h.prefix + name + "."
+	return &c
+}
+
+// format renders a record as "message key=value ..." for the external logger.
+func (h *levelHandler) format(r slog.Record) string {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	for _, a := range h.attrs {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s%s=%v", h.prefix, a.Key, a.Value)
+		return true
+	})
+	return b.String()
+}
+
+// fromSlog maps a slog level to the closest Level.
+func fromSlog(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return DebugLevel
+	case level < slog.LevelWarn:
+		return InfoLevel
+	case level < slog.LevelError:
+		return WarnLevel
+	default:
+		return ErrorLevel
+	}
+}
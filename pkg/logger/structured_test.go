@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type recorder struct {
+	logs []string
+}
+
+func (r *recorder) Log(level Level, msg string) { r.logs = append(r.logs, toString(level)+": "+msg) }
+func (r *recorder) Flush()                      {}
+
+func TestStructured_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewJSON(&buf).With("service", "stream")
+	l.Info("request served", "status", 200, "path", "/chat")
+	l.Printf("legacy %s", "message")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[0], err)
+	}
+	for key, want := range map[string]any{"level": "INFO", "msg": "request served", "service": "stream", "status": float64(200), "path": "/chat"} {
+		if entry[key] != want {
+			t.Errorf("%s = %v; want %v", key, entry[key], want)
+		}
+	}
+	if !strings.Contains(lines[1], `"msg":"legacy message"`) {
+		t.Errorf("expected Printf to log the formatted message, got %s", lines[1])
+	}
+}
+
+func TestStructured_Level(t *testing.T) {
+	defer SetLevel(GetLevel())
+
+	var buf bytes.Buffer
+	l := NewText(&buf)
+
+	l.Debug("hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("expected debug messages to be dropped at info level, got %q", buf.String())
+	}
+
+	if err := SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	l.Debug("shown")
+	if !strings.Contains(buf.String(), "level=DEBUG msg=shown") {
+		t.Fatalf("expected the debug message after SetLevel, got %q", buf.String())
+	}
+
+	buf.Reset()
+	SetLevel("warn")
+	l.Info("hidden")
+	l.Warn("careful")
+	if got := buf.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "level=WARN msg=careful") {
+		t.Fatalf("expected only the warning at warn level, got %q", got)
+	}
+}
+
+func TestSetContextLevel(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := NewContext(context.Background(), NewText(&buf).With("request_id", "abc"))
+
+	SetContextLevel(ctx, DebugLevel)
+	l, _ := FromContext(ctx)
+	l.Debug("chunk", "index", 1)
+	if !strings.Contains(buf.String(), "level=DEBUG msg=chunk request_id=abc index=1") {
+		t.Fatalf("expected the debug message of the request at info level, got %q", buf.String())
+	}
+
+	buf.Reset()
+	NewText(&buf).Debug("hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("expected other loggers to keep the current level, got %q", buf.String())
+	}
+}
+
+func TestStructured_External(t *testing.T) {
+	rec := &recorder{}
+	mu.Lock()
+	state.external = rec
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		state.external = nil
+		mu.Unlock()
+	}()
+
+	var buf bytes.Buffer
+	l := NewText(&buf).With("request_id", "abc")
+	l.Error("upstream failed", "error", errors.New("timeout"))
+
+	if len(rec.logs) != 1 || rec.logs[0] != "error: upstream failed request_id=abc error=timeout" {
+		t.Fatalf("unexpected external logs: %q", rec.logs)
+	}
+}